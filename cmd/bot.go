@@ -3,13 +3,17 @@ package main
 import (
 	"KinopoiskTwoActors/configs"
 	"KinopoiskTwoActors/configs/loader/dotEnvLoader"
+	"KinopoiskTwoActors/internal/delivery/api"
+	"KinopoiskTwoActors/internal/delivery/health"
 	"KinopoiskTwoActors/internal/delivery/telegram"
 	"KinopoiskTwoActors/internal/repository/SessionStates"
 	"KinopoiskTwoActors/internal/repository/cachedRepo"
 	"KinopoiskTwoActors/internal/repository/kinopoisk"
+	"KinopoiskTwoActors/internal/repository/memoryCache"
 	"KinopoiskTwoActors/internal/repository/redisCache"
 	"KinopoiskTwoActors/internal/usecase"
 	"KinopoiskTwoActors/pkg/logger"
+	"KinopoiskTwoActors/pkg/tracing"
 	"context"
 	"errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -52,49 +56,96 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	repo := kinopoisk.NewRepo(cfg)
-	cache, err := redisCache.NewCache(ctx, cfg, "movie:", log)
-	var actor telegram.ActorProvider
-	var film telegram.FilmProvider
-
-	if err == nil {
-		cachedRepo := cachedRepo.NewCachedRepo(repo, cache, log)
-		actor = usecase.NewActor(cachedRepo)
-		film = usecase.NewFilm(cachedRepo)
-	} else {
-		actor = usecase.NewActor(repo)
-		film = usecase.NewFilm(repo)
+	shutdownTracing, err := tracing.Init(ctx, cfg)
+	if err != nil {
+		log.Error("ошибка инициализации трассировки", "error", err)
+		os.Exit(1)
+	}
+
+	remote := redisCache.NewHealthCheckedCache(ctx, cfg, "kinopoisk:", log)
+	go remote.Run(ctx)
+	cache := cachedRepo.NewTieredCache(memoryCache.NewCache(cfg), remote)
+	usage := kinopoisk.NewFallbackUsage(remote, kinopoisk.NewMemoryUsage())
+	kinopoiskRepo := kinopoisk.NewRepo(cfg, usage, log)
+	repo := cachedRepo.NewCachedRepo(kinopoiskRepo, cache, log)
+	actor := usecase.NewActor(repo)
+	film := usecase.NewFilm(repo, cfg.KP.Concurrency)
+
+	var states telegram.StateProvider = SessionStates.NewUserStates()
+	if cfg.Session.Store == configs.SessionStoreRedis {
+		// Sessions kept in memory would be lost on restart without anyone noticing, so Redis is required.
+		if err := remote.Ping(ctx); err != nil {
+			log.Error("Redis недоступен, а SESSION_STORE=redis", "error", err)
+			os.Exit(1)
+		}
+		states = SessionStates.NewRedisStates(remote.Client(), cfg.Session.TTL, log)
 	}
 
-	states := SessionStates.NewUserStates()
+	bot, err := telegram.NewBot(cfg, states, actor, film, log)
+	if err != nil {
+		log.Error("ошибка при создании бота", "error", err)
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+	if cfg.TG.Mode == configs.TelegramModeWebhook {
+		mux.Handle(cfg.TG.WebhookPath, bot.WebhookHandler())
+	}
+	if len(cfg.API.Keys) > 0 {
+		mux.Handle(api.Prefix, api.NewHandler(cfg, actor, film, log))
+	}
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", health.Live)
+	mux.Handle("/readyz", health.NewReadiness(cfg.HTTP.HealthTimeout,
+		health.Check{Name: "telegram", Critical: true, Probe: bot.Ping},
+		health.Check{Name: "kinopoisk", Critical: true, Probe: kinopoiskRepo.Ping},
+		// Redis is only a cache unless sessions are kept in it.
+		health.Check{Name: "redis", Critical: cfg.Session.Store == configs.SessionStoreRedis, Probe: remote.Ping},
+	))
 
 	httpSrv := &http.Server{
-		Addr:    ":8080",
-		Handler: promhttp.Handler(),
+		Addr:    cfg.HTTP.Addr,
+		Handler: mux,
 	}
 	go func() {
-		log.Info("Запуск prometheus на порту 8080")
+		log.Info("Запуск HTTP сервера", "addr", cfg.HTTP.Addr)
 		if err := httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Error("HTTP server error: ", err)
+			log.Error("HTTP server error", "error", err)
 			os.Exit(1)
 		}
 	}()
 
-	bot, err := telegram.NewBot(cfg, states, actor, film, log)
-	if err != nil {
-		log.Error("ошибка при создании бота: ", err)
-		os.Exit(1)
-	}
-	log.Info("Запуск бота")
+	log.Info("Запуск бота", "mode", cfg.TG.Mode)
 
-	go bot.Run(ctx)
+	botCtx, stopBot := context.WithCancel(ctx)
+	botDone := make(chan struct{})
+	go func() {
+		defer close(botDone)
+		bot.Run(botCtx)
+	}()
 
 	<-done
-	gracefulShutdown(ctx, httpSrv, bot, log)
+	gracefulShutdown(ctx, httpSrv, bot, stopBot, botDone, log)
+
+	// Repositories and Redis are used by the handlers, so they are closed only after the bot has stopped.
+	cancel()
+	repo.Wait()
+	if err := remote.Close(); err != nil {
+		log.Error("Ошибка закрытия подключения к Redis", "error", err)
+	}
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Error("Ошибка отправки трасс", "error", err)
+	}
 
 }
 
-func gracefulShutdown(parentCtx context.Context, httpSrv *http.Server, bot *telegram.Bot, log *slog.Logger) {
+// gracefulShutdown stops the bot and waits until Run has handled the queued updates,
+// together with the HTTP server, within the shutdown timeout.
+func gracefulShutdown(parentCtx context.Context, httpSrv *http.Server, bot *telegram.Bot,
+	stopBot context.CancelFunc, botDone <-chan struct{}, log *slog.Logger) {
 	log.Info("Остановка сервисов")
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(parentCtx, 5*time.Second)
@@ -104,6 +155,12 @@ func gracefulShutdown(parentCtx context.Context, httpSrv *http.Server, bot *tele
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		stopBot()
+		select {
+		case <-botDone:
+		case <-shutdownCtx.Done():
+			return
+		}
 		bot.Stop(shutdownCtx)
 	}()
 
@@ -111,7 +168,7 @@ func gracefulShutdown(parentCtx context.Context, httpSrv *http.Server, bot *tele
 	go func() {
 		defer wg.Done()
 		if err := httpSrv.Shutdown(shutdownCtx); err != nil {
-			log.Error("Ошибка остановки HTTP сервера: ", err)
+			log.Error("Ошибка остановки HTTP сервера", "error", err)
 		}
 	}()
 
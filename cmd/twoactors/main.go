@@ -0,0 +1,154 @@
+// Command twoactors prints the movies shared by two or more actors.
+//
+//	twoactors [flags] ACTOR ACTOR [ACTOR...]
+//
+// Actors are given by name or Kinopoisk ID. The Kinopoisk keys and the cache are configured
+// with the same environment variables and .env file as the bot.
+package main
+
+import (
+	"KinopoiskTwoActors/configs"
+	"KinopoiskTwoActors/configs/loader/dotEnvLoader"
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/internal/repository/cachedRepo"
+	"KinopoiskTwoActors/internal/repository/kinopoisk"
+	"KinopoiskTwoActors/internal/repository/memoryCache"
+	"KinopoiskTwoActors/internal/repository/redisCache"
+	"KinopoiskTwoActors/internal/usecase"
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type options struct {
+	format    string
+	pick      string
+	noRedis   bool
+	verbose   bool
+	timeout   time.Duration
+	sort      string
+	kind      string
+	minRating float64
+	yearFrom  int
+	yearTo    int
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.format, "format", formatTable, "Формат вывода: table, json или csv")
+	flag.StringVar(&opts.pick, "pick", "",
+		"Номера актеров в результатах поиска через запятую, по одному на аргумент, или first")
+	flag.BoolVar(&opts.noRedis, "no-redis", false, "Не использовать кэш Redis")
+	flag.BoolVar(&opts.verbose, "v", false, "Подробный лог в stderr")
+	flag.DurationVar(&opts.timeout, "timeout", time.Minute, "Ограничение времени запроса")
+	flag.StringVar(&opts.sort, "sort", "", "Сортировка: year_asc, year_desc или rating_desc")
+	flag.StringVar(&opts.kind, "kind", "", "Тип: film или series")
+	flag.Float64Var(&opts.minRating, "min-rating", 0, "Минимальный рейтинг Кинопоиска")
+	flag.IntVar(&opts.yearFrom, "year-from", 0, "Год выхода от")
+	flag.IntVar(&opts.yearTo, "year-to", 0, "Год выхода до")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Использование: %s [флаги] АКТЕР АКТЕР [АКТЕР...]\n\n"+
+			"Актер задается именем или ID Кинопоиска.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	cfg := configs.MustLoadClient(dotEnvLoader.DotEnvLoader{})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg, opts, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "twoactors:", err)
+		if errors.Is(err, errUsage) {
+			flag.Usage()
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("нужно указать минимум двух актеров")
+
+func run(ctx context.Context, cfg *configs.Config, opts options, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	writer, err := newWriter(opts.format)
+	if err != nil {
+		return err
+	}
+	movieOpts, err := movieOptions(opts)
+	if err != nil {
+		return err
+	}
+	picks, err := parsePicks(opts.pick, len(args))
+	if err != nil {
+		return err
+	}
+
+	level := slog.LevelError
+	if opts.verbose {
+		level = slog.LevelDebug
+	}
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	var usage kinopoisk.UsageCounter = kinopoisk.NewMemoryUsage()
+	var remote cachedRepo.CacheRepository
+	if !opts.noRedis {
+		redis := redisCache.NewHealthCheckedCache(ctx, cfg, "kinopoisk:", log)
+		remote = redis
+		usage = kinopoisk.NewFallbackUsage(redis, usage)
+	}
+	cache := cachedRepo.NewTieredCache(memoryCache.NewCache(cfg), remote)
+	repo := cachedRepo.NewCachedRepo(kinopoisk.NewRepo(cfg, usage, log), cache, log)
+	defer repo.Wait()
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	r := &resolver{
+		actors:      usecase.NewActor(repo),
+		picks:       picks,
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stderr,
+		interactive: isTerminal(os.Stdin),
+	}
+	actorIDs, err := r.resolve(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	movies, err := usecase.NewFilm(repo, cfg.KP.Concurrency).GetCommonMovies(ctx, actorIDs, movieOpts)
+	if errors.Is(err, domain.ErrPartialResult) {
+		fmt.Fprintln(os.Stderr, "twoactors: список может быть неполным:", err)
+	} else if err != nil {
+		return err
+	}
+	return writer(os.Stdout, movies)
+}
+
+func movieOptions(opts options) (domain.MovieOptions, error) {
+	movieOpts := domain.MovieOptions{
+		Sort:      domain.MovieSort(opts.sort),
+		MinRating: float32(opts.minRating),
+		YearFrom:  opts.yearFrom,
+		YearTo:    opts.yearTo,
+		Kind:      domain.MovieKind(opts.kind),
+	}
+	if err := movieOpts.Validate(); err != nil {
+		return domain.MovieOptions{}, err
+	}
+	return movieOpts, nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// movie is the output form of a common movie.
+type movie struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name"`
+	EngName  string  `json:"enName,omitempty"`
+	Year     int     `json:"year"`
+	Rating   float32 `json:"rating"`
+	IsSeries bool    `json:"isSeries"`
+	URL      string  `json:"url"`
+}
+
+func toOutput(movies []domain.Movie) []movie {
+	out := make([]movie, 0, len(movies))
+	for _, m := range movies {
+		out = append(out, movie{
+			ID:       m.ID,
+			Name:     m.Name,
+			EngName:  m.EngName,
+			Year:     m.Year,
+			Rating:   m.Rating,
+			IsSeries: m.IsSeries,
+			URL:      m.MovieURL,
+		})
+	}
+	return out
+}
+
+type writer func(w io.Writer, movies []domain.Movie) error
+
+func newWriter(format string) (writer, error) {
+	switch format {
+	case formatTable:
+		return writeTable, nil
+	case formatJSON:
+		return writeJSON, nil
+	case formatCSV:
+		return writeCSV, nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат вывода %q", format)
+	}
+}
+
+func writeTable(w io.Writer, movies []domain.Movie) error {
+	if len(movies) == 0 {
+		_, err := fmt.Fprintln(w, "У актеров нет общих фильмов")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tНазвание\tОригинальное название\tГод\tРейтинг\tТип\tСсылка")
+	for _, m := range toOutput(movies) {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%.1f\t%s\t%s\n",
+			m.ID, m.Name, m.EngName, m.Year, m.Rating, kindLabel(m.IsSeries), m.URL)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, movies []domain.Movie) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(toOutput(movies))
+}
+
+func writeCSV(w io.Writer, movies []domain.Movie) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "name", "enName", "year", "rating", "isSeries", "url"})
+	for _, m := range toOutput(movies) {
+		_ = cw.Write([]string{
+			strconv.Itoa(m.ID),
+			m.Name,
+			m.EngName,
+			strconv.Itoa(m.Year),
+			strconv.FormatFloat(float64(m.Rating), 'f', 1, 32),
+			strconv.FormatBool(m.IsSeries),
+			m.URL,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func kindLabel(isSeries bool) string {
+	if isSeries {
+		return "сериал"
+	}
+	return "фильм"
+}
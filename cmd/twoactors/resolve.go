@@ -0,0 +1,130 @@
+package main
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pickFirst makes every ambiguous name resolve to the first search result.
+const pickFirst = "first"
+
+type actorSearcher interface {
+	SearchActor(ctx context.Context, query string) ([]domain.Actor, error)
+}
+
+// resolver turns actor arguments into Kinopoisk IDs. Numbers are used as IDs as is,
+// names are searched and ambiguous results are resolved with picks or by asking the user.
+type resolver struct {
+	actors actorSearcher
+	// picks holds the 1-based search result to use for every argument; 0 means not set.
+	picks       []int
+	in          *bufio.Reader
+	out         io.Writer
+	interactive bool
+}
+
+func (r *resolver) resolve(ctx context.Context, args []string) ([]int, error) {
+	ids := make([]int, 0, len(args))
+	for i, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if id, err := strconv.Atoi(arg); err == nil && id > 0 {
+			ids = append(ids, id)
+			continue
+		}
+
+		actors, err := r.actors.SearchActor(ctx, arg)
+		if err != nil {
+			return nil, fmt.Errorf("актер %q не найден: %w", arg, err)
+		}
+		actor, err := r.choose(arg, actors, r.picks[i])
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, actor.ID)
+	}
+	return ids, nil
+}
+
+func (r *resolver) choose(query string, actors []domain.Actor, pick int) (domain.Actor, error) {
+	switch {
+	case pick > len(actors):
+		return domain.Actor{}, fmt.Errorf("по запросу %q найдено актеров: %d, выбран номер %d",
+			query, len(actors), pick)
+	case pick > 0:
+		return actors[pick-1], nil
+	case len(actors) == 1:
+		return actors[0], nil
+	case !r.interactive:
+		return domain.Actor{}, fmt.Errorf("по запросу %q найдено несколько актеров, укажите -pick:\n%s",
+			query, formatCandidates(actors))
+	}
+
+	fmt.Fprintf(r.out, "По запросу %q найдено несколько актеров:\n%s", query, formatCandidates(actors))
+	for {
+		fmt.Fprintf(r.out, "Выберите номер [1-%d]: ", len(actors))
+		line, err := r.in.ReadString('\n')
+		if n, convErr := strconv.Atoi(strings.TrimSpace(line)); convErr == nil && n >= 1 && n <= len(actors) {
+			return actors[n-1], nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return domain.Actor{}, fmt.Errorf("актер по запросу %q не выбран", query)
+			}
+			return domain.Actor{}, err
+		}
+	}
+}
+
+func formatCandidates(actors []domain.Actor) string {
+	var sb strings.Builder
+	for i, actor := range actors {
+		fmt.Fprintf(&sb, "  %d. %s", i+1, actor.Name)
+		if actor.EngName != "" {
+			fmt.Fprintf(&sb, " (%s)", actor.EngName)
+		}
+		if birthday, err := time.Parse(time.RFC3339, actor.Birthday); err == nil {
+			fmt.Fprintf(&sb, ", %d", birthday.Year())
+		}
+		fmt.Fprintf(&sb, ", ID %d\n", actor.ID)
+	}
+	return sb.String()
+}
+
+// parsePicks parses the -pick flag for count arguments.
+func parsePicks(value string, count int) ([]int, error) {
+	picks := make([]int, count)
+	value = strings.TrimSpace(value)
+	switch value {
+	case "":
+		return picks, nil
+	case pickFirst:
+		for i := range picks {
+			picks[i] = 1
+		}
+		return picks, nil
+	}
+
+	parts := strings.Split(value, ",")
+	if len(parts) > count {
+		return nil, fmt.Errorf("в -pick %d значений, а актеров %d", len(parts), count)
+	}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pick, err := strconv.Atoi(part)
+		if err != nil || pick < 0 {
+			return nil, fmt.Errorf("неверный номер актера в -pick: %q", part)
+		}
+		picks[i] = pick
+	}
+	return picks, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/internal/repository/kinopoisk"
+	"KinopoiskTwoActors/internal/repository/kinopoisk/kinopoisktest"
+	"KinopoiskTwoActors/internal/usecase"
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePicks(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		count   int
+		want    []int
+		wantErr bool
+	}{
+		{name: "empty", value: "", count: 2, want: []int{0, 0}},
+		{name: "first", value: "first", count: 3, want: []int{1, 1, 1}},
+		{name: "per argument", value: "2,,1", count: 3, want: []int{2, 0, 1}},
+		{name: "fewer than arguments", value: "3", count: 2, want: []int{3, 0}},
+		{name: "more than arguments", value: "1,1,1", count: 2, wantErr: true},
+		{name: "not a number", value: "a", count: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePicks(tt.value, tt.count)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePicks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("parsePicks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolverResolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		picks       []int
+		interactive bool
+		input       string
+		want        []int
+		wantErr     string
+	}{
+		{name: "ids", args: []string{"1514", "8027"}, want: []int{1514, 8027}},
+		{name: "exact names", args: []string{"Том Харди", "Cillian Murphy"}, want: []int{1514, 8027}},
+		{
+			name:    "ambiguous name without pick",
+			args:    []string{"Том", "8027"},
+			wantErr: "укажите -pick",
+		},
+		{
+			name:  "ambiguous name with pick",
+			args:  []string{"8027", "Том"},
+			picks: []int{0, 1},
+			want:  []int{8027, 1514},
+		},
+		{
+			name:    "pick out of range",
+			args:    []string{"Том Харди", "8027"},
+			picks:   []int{2, 0},
+			wantErr: "выбран номер 2",
+		},
+		{
+			name:        "asks until a valid number",
+			args:        []string{"Том", "8027"},
+			interactive: true,
+			input:       "abc\n7\n1\n",
+			want:        []int{1514, 8027},
+		},
+		{
+			name:        "input ends without choice",
+			args:        []string{"Том", "8027"},
+			interactive: true,
+			input:       "",
+			wantErr:     "не выбран",
+		},
+		{name: "not found", args: []string{"Несуществующий Актер", "8027"}, wantErr: "не найден"},
+	}
+
+	srv := kinopoisktest.NewServer(kinopoisktest.DefaultFixtures())
+	defer srv.Close()
+	repo := kinopoisk.NewRepo(srv.Config(), kinopoisk.NewMemoryUsage(), slog.New(slog.DiscardHandler))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picks := tt.picks
+			if picks == nil {
+				picks = make([]int, len(tt.args))
+			}
+			r := &resolver{
+				actors:      usecase.NewActor(repo),
+				picks:       picks,
+				in:          bufio.NewReader(strings.NewReader(tt.input)),
+				out:         io.Discard,
+				interactive: tt.interactive,
+			}
+
+			got, err := r.resolve(context.Background(), tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolve() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriters(t *testing.T) {
+	movies := []domain.Movie{
+		{ID: 716587, Name: "Острые козырьки", EngName: "Peaky Blinders", Year: 2013, Rating: 8.6,
+			IsSeries: true, MovieURL: "https://www.kinopoisk.ru/film/716587/"},
+		{ID: 447301, Name: "Начало, фильм", Year: 2010, Rating: 8.7,
+			MovieURL: "https://www.kinopoisk.ru/film/447301/"},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: formatCSV,
+			want: "id,name,enName,year,rating,isSeries,url\n" +
+				"716587,Острые козырьки,Peaky Blinders,2013,8.6,true,https://www.kinopoisk.ru/film/716587/\n" +
+				"447301,\"Начало, фильм\",,2010,8.7,false,https://www.kinopoisk.ru/film/447301/\n",
+		},
+		{
+			format: formatJSON,
+			want: `[
+  {
+    "id": 716587,
+    "name": "Острые козырьки",
+    "enName": "Peaky Blinders",
+    "year": 2013,
+    "rating": 8.6,
+    "isSeries": true,
+    "url": "https://www.kinopoisk.ru/film/716587/"
+  },
+  {
+    "id": 447301,
+    "name": "Начало, фильм",
+    "year": 2010,
+    "rating": 8.7,
+    "isSeries": false,
+    "url": "https://www.kinopoisk.ru/film/447301/"
+  }
+]
+`,
+		},
+		{
+			format: formatTable,
+			want: "ID      Название         Оригинальное название  Год   Рейтинг  Тип     Ссылка\n" +
+				"716587  Острые козырьки  Peaky Blinders         2013  8.6      сериал  https://www.kinopoisk.ru/film/716587/\n" +
+				"447301  Начало, фильм                           2010  8.7      фильм   https://www.kinopoisk.ru/film/447301/\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			write, err := newWriter(tt.format)
+			if err != nil {
+				t.Fatalf("newWriter() error = %v", err)
+			}
+			var buf bytes.Buffer
+			if err = write(&buf, movies); err != nil {
+				t.Fatalf("write() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
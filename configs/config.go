@@ -6,12 +6,21 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type KinopoiskConfig struct {
-	Token string `validate:"required"`
-	Path  string `validate:"required"`
+	Tokens         []string `validate:"required"`
+	Path           string   `validate:"required"`
+	KeyQuarantine  time.Duration
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	RateLimit      float64
+	RateBurst      int
+	DailyQuota     int
+	Concurrency    int
 }
 
 type RedisConfig struct {
@@ -23,21 +32,107 @@ type RedisConfig struct {
 	DialTimeout  time.Duration `validate:"required"`
 	ReadTimeout  time.Duration `validate:"required"`
 	WriteTimeout time.Duration `validate:"required"`
+	// HealthInterval is how often an unreachable Redis is probed again.
+	HealthInterval time.Duration
+}
+
+const (
+	TelegramModePolling = "polling"
+	TelegramModeWebhook = "webhook"
+)
+
+type CacheConfig struct {
+	MovieTTL       time.Duration
+	FilmographyTTL time.Duration
+	SearchTTL      time.Duration
+	MemorySize     int
+	MemoryTTL      time.Duration
+	// StaleTTL is how long entries past their TTL are still served while being refreshed.
+	StaleTTL time.Duration
+	// NegativeTTL is how long "not found" answers are cached. Zero disables negative caching.
+	NegativeTTL time.Duration
 }
 
 type TelegramConfig struct {
 	Token             string        `validate:"required"`
 	ConnectionTimeout time.Duration `validate:"required"`
+	Mode              string
+	WebhookURL        string
+	WebhookSecret     string
+	WebhookPath       string
+	Workers           int
+	QueueSize         int
+	// APIEndpoint is the Bot API URL format with the token and method placeholders.
+	// When empty the public https://api.telegram.org is used.
+	APIEndpoint string
+	// InlineCacheTime is how long Telegram may cache the answer to an inline query.
+	InlineCacheTime time.Duration
+}
+
+const (
+	SessionStoreMemory = "memory"
+	SessionStoreRedis  = "redis"
+)
+
+type SessionConfig struct {
+	Store           string
+	TTL             time.Duration
+	IdleTimeout     time.Duration
+	CleanupInterval time.Duration
+}
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+type TracingConfig struct {
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector URL. When empty the standard OTEL_EXPORTER_OTLP_* variables apply.
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+}
+
+type HTTPConfig struct {
+	Addr          string
+	HealthTimeout time.Duration
+}
+
+type APIConfig struct {
+	// Keys are accepted by the REST API. The API is disabled when there are none.
+	Keys []string
+	// RateLimit is the number of requests per second allowed for each key, 0 means no limit.
+	RateLimit float64
+	RateBurst int
+	Timeout   time.Duration
 }
 
 type Config struct {
-	KP  KinopoiskConfig
-	TG  TelegramConfig
-	RD  RedisConfig
-	Env string
+	KP      KinopoiskConfig
+	TG      TelegramConfig
+	RD      RedisConfig
+	Cache   CacheConfig
+	Session SessionConfig
+	HTTP    HTTPConfig
+	API     APIConfig
+	Tracing TracingConfig
+	Env     string
 }
 
+// MustLoad loads the bot configuration and exits if it is invalid.
 func MustLoad(loader loader.ConfigLoader) *Config {
+	return mustLoad(loader, validateConfig)
+}
+
+// MustLoadClient loads the configuration of tools that only query Kinopoisk,
+// so the Telegram settings are not required.
+func MustLoadClient(loader loader.ConfigLoader) *Config {
+	return mustLoad(loader, validateClientConfig)
+}
+
+func mustLoad(loader loader.ConfigLoader, validate func(cfg *Config) error) *Config {
 	env := flag.String("env", "dev", "Environment type")
 	flag.Parse()
 
@@ -46,39 +141,158 @@ func MustLoad(loader loader.ConfigLoader) *Config {
 	if err != nil {
 		log.Fatalf("%s: config load failed: %+v", op, err)
 	}
-	cfg := &Config{
+	cfg := newConfig(envs, *env)
+	if err := validate(cfg); err != nil {
+		log.Fatalf("%s: config validation failed: %+v", op, err)
+	}
+
+	return cfg
+}
+
+// newConfig builds the configuration from environment variables, using defaults for the missing ones.
+func newConfig(envs map[string]string, env string) *Config {
+	return &Config{
 		KP: KinopoiskConfig{
-			Token: envs["KINOPOISK_TOKEN"],
-			Path:  envs["KINOPOISK_PATH"],
+			Tokens:         getEnvAsList(envs["KINOPOISK_TOKEN"]),
+			Path:           envs["KINOPOISK_PATH"],
+			KeyQuarantine:  getEnvAsDuration(envs["KINOPOISK_KEY_QUARANTINE"], time.Hour),
+			MaxRetries:     getEnvAsInt(envs["KINOPOISK_MAX_RETRIES"], 3),
+			RetryBaseDelay: getEnvAsDuration(envs["KINOPOISK_RETRY_BASE_DELAY"], 200*time.Millisecond),
+			RetryMaxDelay:  getEnvAsDuration(envs["KINOPOISK_RETRY_MAX_DELAY"], 5*time.Second),
+			RateLimit:      getEnvAsFloat(envs["KINOPOISK_RATE_LIMIT"], 5),
+			RateBurst:      getEnvAsInt(envs["KINOPOISK_RATE_BURST"], 5),
+			DailyQuota:     getEnvAsInt(envs["KINOPOISK_DAILY_QUOTA"], 200),
+			Concurrency:    getEnvAsInt(envs["KINOPOISK_CONCURRENCY"], 4),
 		},
 		TG: TelegramConfig{
 			Token:             envs["TELEGRAM_TOKEN"],
 			ConnectionTimeout: getEnvAsDuration(envs["TELEGRAM_CONNECTION_TIMEOUT"], 5*time.Second),
+			APIEndpoint:       envs["TELEGRAM_API_ENDPOINT"],
+			Mode:              getEnvAsString(envs["TELEGRAM_MODE"], TelegramModePolling),
+			WebhookURL:        envs["TELEGRAM_WEBHOOK_URL"],
+			WebhookSecret:     envs["TELEGRAM_WEBHOOK_SECRET"],
+			WebhookPath:       getEnvAsString(envs["TELEGRAM_WEBHOOK_PATH"], "/telegram/webhook"),
+			Workers:           getEnvAsInt(envs["TELEGRAM_WORKERS"], 8),
+			QueueSize:         getEnvAsInt(envs["TELEGRAM_QUEUE_SIZE"], 100),
+			InlineCacheTime:   getEnvAsDuration(envs["TELEGRAM_INLINE_CACHE_TIME"], 5*time.Minute),
 		},
 		RD: RedisConfig{
-			Host:         envs["REDIS_HOST"],
-			DB:           getEnvAsInt(envs["REDIS_DB"], 0),
-			User:         envs["REDIS_USER"],
-			Password:     envs["REDIS_PASSWORD"],
-			MaxRetries:   getEnvAsInt(envs["REDIS_MAX_RETRIES"], 3),
-			DialTimeout:  getEnvAsDuration(envs["REDIS_DIAL_TIMEOUT"], 5*time.Second),
-			ReadTimeout:  getEnvAsDuration(envs["REDIS_READ_TIMEOUT"], 5*time.Second),
-			WriteTimeout: getEnvAsDuration(envs["REDIS_WRITE_TIMEOUT"], 5*time.Second),
+			Host:           envs["REDIS_HOST"],
+			DB:             getEnvAsInt(envs["REDIS_DB"], 0),
+			User:           envs["REDIS_USER"],
+			Password:       envs["REDIS_PASSWORD"],
+			MaxRetries:     getEnvAsInt(envs["REDIS_MAX_RETRIES"], 3),
+			DialTimeout:    getEnvAsDuration(envs["REDIS_DIAL_TIMEOUT"], 5*time.Second),
+			ReadTimeout:    getEnvAsDuration(envs["REDIS_READ_TIMEOUT"], 5*time.Second),
+			WriteTimeout:   getEnvAsDuration(envs["REDIS_WRITE_TIMEOUT"], 5*time.Second),
+			HealthInterval: getEnvAsDuration(envs["REDIS_HEALTH_INTERVAL"], 10*time.Second),
+		},
+		Cache: CacheConfig{
+			MovieTTL:       getEnvAsDuration(envs["CACHE_MOVIE_TTL"], 24*time.Hour),
+			FilmographyTTL: getEnvAsDuration(envs["CACHE_FILMOGRAPHY_TTL"], 72*time.Hour),
+			SearchTTL:      getEnvAsDuration(envs["CACHE_SEARCH_TTL"], 6*time.Hour),
+			MemorySize:     getEnvAsInt(envs["CACHE_MEMORY_SIZE"], 10000),
+			MemoryTTL:      getEnvAsDuration(envs["CACHE_MEMORY_TTL"], 10*time.Minute),
+			StaleTTL:       getEnvAsDuration(envs["CACHE_STALE_TTL"], 24*time.Hour),
+			NegativeTTL:    getEnvAsDuration(envs["CACHE_NEGATIVE_TTL"], 15*time.Minute),
+		},
+		Session: SessionConfig{
+			Store:           getEnvAsString(envs["SESSION_STORE"], SessionStoreMemory),
+			TTL:             getEnvAsDuration(envs["SESSION_TTL"], 24*time.Hour),
+			IdleTimeout:     getEnvAsDuration(envs["SESSION_IDLE_TIMEOUT"], 30*time.Minute),
+			CleanupInterval: getEnvAsDuration(envs["SESSION_CLEANUP_INTERVAL"], time.Minute),
 		},
-		Env: *env,
+		HTTP: HTTPConfig{
+			Addr:          getEnvAsString(envs["HTTP_ADDR"], ":8080"),
+			HealthTimeout: getEnvAsDuration(envs["HTTP_HEALTH_TIMEOUT"], 3*time.Second),
+		},
+		API: APIConfig{
+			Keys:      getEnvAsList(envs["API_KEYS"]),
+			RateLimit: getEnvAsFloat(envs["API_RATE_LIMIT"], 2),
+			RateBurst: getEnvAsInt(envs["API_RATE_BURST"], 10),
+			Timeout:   getEnvAsDuration(envs["API_TIMEOUT"], 30*time.Second),
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnvAsString(envs["TRACING_EXPORTER"], TracingExporterNone),
+			Endpoint:    envs["TRACING_OTLP_ENDPOINT"],
+			ServiceName: getEnvAsString(envs["TRACING_SERVICE_NAME"], "kinopoisk-two-actors-bot"),
+			SampleRatio: getEnvAsFloat(envs["TRACING_SAMPLE_RATIO"], 1),
+		},
+		Env: env,
 	}
+}
 
-	if err := validateConfig(cfg); err != nil {
-		log.Fatalf("%s: config validation failed: %+v", op, err)
+func validateConfig(cfg *Config) error {
+	if cfg.TG.Token == "" {
+		return fmt.Errorf("missing required configuration")
 	}
-
-	return cfg
+	if err := validateClientConfig(cfg); err != nil {
+		return err
+	}
+	if cfg.TG.Workers <= 0 || cfg.TG.QueueSize < 0 {
+		return fmt.Errorf("invalid telegram worker pool configuration")
+	}
+	if cfg.TG.InlineCacheTime < time.Second {
+		return fmt.Errorf("invalid telegram inline cache time")
+	}
+	if cfg.HTTP.HealthTimeout <= 0 {
+		return fmt.Errorf("invalid http health timeout")
+	}
+	if cfg.API.RateLimit < 0 || cfg.API.RateBurst <= 0 || cfg.API.Timeout <= 0 {
+		return fmt.Errorf("invalid api configuration")
+	}
+	if cfg.Session.Store != SessionStoreMemory && cfg.Session.Store != SessionStoreRedis {
+		return fmt.Errorf("unknown session store %q", cfg.Session.Store)
+	}
+	if cfg.Session.TTL <= 0 || cfg.Session.IdleTimeout <= 0 || cfg.Session.CleanupInterval <= 0 {
+		return fmt.Errorf("invalid session expiry configuration")
+	}
+	switch cfg.TG.Mode {
+	case TelegramModePolling:
+	case TelegramModeWebhook:
+		if cfg.TG.WebhookURL == "" || cfg.TG.WebhookSecret == "" {
+			return fmt.Errorf("webhook mode requires TELEGRAM_WEBHOOK_URL and TELEGRAM_WEBHOOK_SECRET")
+		}
+	default:
+		return fmt.Errorf("unknown telegram mode %q", cfg.TG.Mode)
+	}
+	return nil
 }
 
-func validateConfig(cfg *Config) error {
-	if cfg.KP.Token == "" || cfg.TG.Token == "" {
+// validateClientConfig checks the settings shared by the bot and the command-line tools.
+func validateClientConfig(cfg *Config) error {
+	if len(cfg.KP.Tokens) == 0 {
 		return fmt.Errorf("missing required configuration")
 	}
+	if cfg.KP.MaxRetries < 0 || cfg.KP.RetryBaseDelay <= 0 ||
+		cfg.KP.RetryMaxDelay < cfg.KP.RetryBaseDelay {
+		return fmt.Errorf("invalid kinopoisk retry configuration")
+	}
+	if cfg.KP.RateLimit < 0 || cfg.KP.RateBurst <= 0 || cfg.KP.DailyQuota < 0 ||
+		cfg.KP.Concurrency <= 0 {
+		return fmt.Errorf("invalid kinopoisk rate limit configuration")
+	}
+	switch cfg.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterStdout, TracingExporterOTLP:
+	default:
+		return fmt.Errorf("unknown tracing exporter %q", cfg.Tracing.Exporter)
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("invalid tracing sample ratio")
+	}
+	if cfg.RD.HealthInterval <= 0 {
+		return fmt.Errorf("invalid redis health interval")
+	}
+	if cfg.Cache.MemorySize < 0 || cfg.Cache.MemoryTTL < 0 {
+		return fmt.Errorf("invalid memory cache configuration")
+	}
+	// Without a TTL entries would never expire in Redis and be stale right away.
+	if cfg.Cache.MovieTTL <= 0 || cfg.Cache.FilmographyTTL <= 0 || cfg.Cache.SearchTTL <= 0 {
+		return fmt.Errorf("invalid cache ttl configuration")
+	}
+	if cfg.Cache.StaleTTL < 0 || cfg.Cache.NegativeTTL < 0 {
+		return fmt.Errorf("invalid cache expiry configuration")
+	}
 	return nil
 }
 
@@ -95,6 +309,36 @@ func getEnvAsDuration(strValue string, defaultValue time.Duration) time.Duration
 	return value
 }
 
+func getEnvAsString(strValue string, defaultValue string) string {
+	if strValue == "" {
+		return defaultValue
+	}
+	return strValue
+}
+
+func getEnvAsList(strValue string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(strValue, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvAsFloat(strValue string, defaultValue float64) float64 {
+	const op = "configs.getEnvAsFloat"
+	if strValue == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(strValue, 64)
+	if err != nil {
+		log.Printf("%s:Invalid value for %s, using default: %v", op, strValue, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
 func getEnvAsInt(strValue string, defaultValue int) int {
 	const op = "configs.getEnvAsInt"
 	if strValue == "" {
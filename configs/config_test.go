@@ -0,0 +1,37 @@
+package configs
+
+import (
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		envs    map[string]string
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "zero movie ttl", envs: map[string]string{"CACHE_MOVIE_TTL": "0s"}, wantErr: true},
+		{name: "negative filmography ttl", envs: map[string]string{"CACHE_FILMOGRAPHY_TTL": "-1h"}, wantErr: true},
+		{name: "zero search ttl", envs: map[string]string{"CACHE_SEARCH_TTL": "0s"}, wantErr: true},
+		{name: "zero session ttl", envs: map[string]string{"SESSION_TTL": "0s"}, wantErr: true},
+		{name: "zero idle timeout", envs: map[string]string{"SESSION_IDLE_TIMEOUT": "0s"}, wantErr: true},
+		{name: "zero negative ttl disables negative caching", envs: map[string]string{"CACHE_NEGATIVE_TTL": "0s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envs := map[string]string{
+				"KINOPOISK_TOKEN": "token",
+				"TELEGRAM_TOKEN":  "token",
+			}
+			for key, value := range tt.envs {
+				envs[key] = value
+			}
+			err := validateConfig(newConfig(envs, "test"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
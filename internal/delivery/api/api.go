@@ -0,0 +1,232 @@
+// Package api serves actor search and common movies over HTTP for other tools.
+package api
+
+import (
+	"KinopoiskTwoActors/configs"
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/internal/usecase"
+	"KinopoiskTwoActors/pkg/logger"
+	"KinopoiskTwoActors/pkg/prometheus"
+	"KinopoiskTwoActors/pkg/tracing"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Prefix is the path the API is mounted on.
+	Prefix = "/api/"
+
+	headerRequestID = "X-Request-ID"
+	maxRequestIDLen = 64
+	minActors       = 2
+	maxActors       = 5
+	anonymous       = "anonymous"
+)
+
+//go:embed openapi.yaml
+var openAPI []byte
+
+// Handler serves the REST API. Every route except the OpenAPI document requires an API key.
+type Handler struct {
+	actors  usecase.ActorProvider
+	films   usecase.FilmProvider
+	clients []*client
+	timeout time.Duration
+	log     *slog.Logger
+	mux     *http.ServeMux
+}
+
+func NewHandler(cfg *configs.Config, actors usecase.ActorProvider, films usecase.FilmProvider,
+	log *slog.Logger) *Handler {
+	h := &Handler{
+		actors:  actors,
+		films:   films,
+		clients: newClients(cfg.API.Keys, cfg.API.RateLimit, cfg.API.RateBurst),
+		timeout: cfg.API.Timeout,
+		log:     log,
+		mux:     http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /api/openapi.yaml", serveOpenAPI)
+	h.mux.Handle("GET /api/actors", h.protect("actors", h.searchActors))
+	h.mux.Handle("GET /api/actors/{id}/movies", h.protect("actor_movies", h.actorMovies))
+	h.mux.Handle("GET /api/common", h.protect("common", h.commonMovies))
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func serveOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(openAPI)
+}
+
+// handlerFunc handles an authenticated request and returns the response status.
+type handlerFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request) int
+
+// protect checks the API key and its rate limit, then runs next with a deadline,
+// a request ID for the logs and a span.
+func (h *Handler) protect(route string, next handlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(headerRequestID)
+		if requestID == "" || len(requestID) > maxRequestIDLen {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(headerRequestID, requestID)
+
+		ctx, span := tracing.Start(r.Context(), "api."+route,
+			attribute.String(logger.CorrelationIDKey, requestID))
+		defer span.End()
+		ctx = logger.WithCorrelationID(ctx, requestID)
+
+		label := anonymous
+		var code int
+		switch c := h.authenticate(r); {
+		case c == nil:
+			code = http.StatusUnauthorized
+			writeError(w, code, "неверный или отсутствующий ключ API")
+		default:
+			label = c.label
+			if ok, retryAfter := c.allow(); !ok {
+				code = http.StatusTooManyRequests
+				w.Header().Set(headerRetryAfter, strconv.Itoa(retryAfter))
+				writeError(w, code, "превышен лимит запросов")
+				break
+			}
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+			code = next(ctx, w, r)
+		}
+
+		span.SetAttributes(attribute.String("api_key", label), attribute.Int("http.status_code", code))
+		prometheus.RESTRequests.WithLabelValues(route, label, strconv.Itoa(code)).Inc()
+	})
+}
+
+func (h *Handler) searchActors(ctx context.Context, w http.ResponseWriter, r *http.Request) int {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		return badRequest(w, "параметр q обязателен")
+	}
+
+	actors, err := h.actors.SearchActor(ctx, query)
+	if err != nil && !errors.Is(err, domain.ErrRecordNotFound) {
+		return h.fail(ctx, w, err)
+	}
+	writeJSON(w, http.StatusOK, actorsResponse{Actors: toActors(actors)})
+	return http.StatusOK
+}
+
+func (h *Handler) actorMovies(ctx context.Context, w http.ResponseWriter, r *http.Request) int {
+	actorID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || actorID <= 0 {
+		return badRequest(w, "неверный ID актера")
+	}
+	opts, err := parseOptions(r)
+	if err != nil {
+		return badRequest(w, err.Error())
+	}
+
+	movies, err := h.films.GetActorMovies(ctx, actorID, opts)
+	return h.writeMovies(ctx, w, movies, err)
+}
+
+func (h *Handler) commonMovies(ctx context.Context, w http.ResponseWriter, r *http.Request) int {
+	values := r.URL.Query()["actor"]
+	if len(values) < minActors || len(values) > maxActors {
+		return badRequest(w, fmt.Sprintf("нужно указать от %d до %d актеров", minActors, maxActors))
+	}
+	actorIDs := make([]int, 0, len(values))
+	for _, value := range values {
+		actorID, err := strconv.Atoi(value)
+		if err != nil || actorID <= 0 {
+			return badRequest(w, fmt.Sprintf("неверный ID актера %q", value))
+		}
+		if slices.Contains(actorIDs, actorID) {
+			return badRequest(w, "актер задублирован")
+		}
+		actorIDs = append(actorIDs, actorID)
+	}
+	opts, err := parseOptions(r)
+	if err != nil {
+		return badRequest(w, err.Error())
+	}
+
+	movies, err := h.films.GetCommonMovies(ctx, actorIDs, opts)
+	return h.writeMovies(ctx, w, movies, err)
+}
+
+// writeMovies answers with the movies. A partial result is still a success and is marked in the body.
+func (h *Handler) writeMovies(ctx context.Context, w http.ResponseWriter, movies []domain.Movie, err error) int {
+	partial := errors.Is(err, domain.ErrPartialResult)
+	if err != nil && !partial {
+		return h.fail(ctx, w, err)
+	}
+	if partial {
+		h.log.WarnContext(ctx, "Список фильмов API неполный", "error", err)
+	}
+	writeJSON(w, http.StatusOK, moviesResponse{Movies: toMovies(movies), Partial: partial})
+	return http.StatusOK
+}
+
+func (h *Handler) fail(ctx context.Context, w http.ResponseWriter, err error) int {
+	code, message := errorStatus(err)
+	if code >= http.StatusInternalServerError {
+		h.log.ErrorContext(ctx, "Ошибка запроса API", "error", err)
+	}
+	writeError(w, code, message)
+	return code
+}
+
+func badRequest(w http.ResponseWriter, message string) int {
+	writeError(w, http.StatusBadRequest, message)
+	return http.StatusBadRequest
+}
+
+// parseOptions reads the filter and sort parameters shared by the movie routes.
+func parseOptions(r *http.Request) (domain.MovieOptions, error) {
+	query := r.URL.Query()
+	opts := domain.MovieOptions{
+		Sort: domain.MovieSort(query.Get("sort")),
+		Kind: domain.MovieKind(query.Get("kind")),
+	}
+	if value := query.Get("min_rating"); value != "" {
+		rating, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return domain.MovieOptions{}, fmt.Errorf("неверный min_rating %q", value)
+		}
+		opts.MinRating = float32(rating)
+	}
+	var err error
+	if opts.YearFrom, err = intParam(query, "year_from"); err != nil {
+		return domain.MovieOptions{}, err
+	}
+	if opts.YearTo, err = intParam(query, "year_to"); err != nil {
+		return domain.MovieOptions{}, err
+	}
+	return opts, opts.Validate()
+}
+
+func intParam(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("неверный %s %q", name, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"KinopoiskTwoActors/internal/repository/kinopoisk"
+	"KinopoiskTwoActors/internal/repository/kinopoisk/kinopoisktest"
+	"KinopoiskTwoActors/internal/usecase"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testKey = "test-api-key"
+
+func newTestHandler(t *testing.T, rateLimit float64, rateBurst int) (*Handler, *kinopoisktest.Server) {
+	t.Helper()
+	kp := kinopoisktest.NewServer(kinopoisktest.DefaultFixtures())
+	t.Cleanup(kp.Close)
+
+	cfg := kp.Config()
+	cfg.API.Keys = []string{"other-key", testKey}
+	cfg.API.RateLimit = rateLimit
+	cfg.API.RateBurst = rateBurst
+	cfg.API.Timeout = 5 * time.Second
+
+	log := slog.New(slog.DiscardHandler)
+	repo := kinopoisk.NewRepo(cfg, kinopoisk.NewMemoryUsage(), log)
+	return NewHandler(cfg, usecase.NewActor(repo), usecase.NewFilm(repo, cfg.KP.Concurrency), log), kp
+}
+
+func get(h http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func authorized() http.Header {
+	return http.Header{headerAPIKey: {testKey}}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		header    http.Header
+		setup     func(kp *kinopoisktest.Server)
+		wantCode  int
+		wantIDs   []int
+		wantError string
+	}{
+		{name: "no key", target: "/api/actors?q=Tom", wantCode: http.StatusUnauthorized},
+		{
+			name:     "wrong key",
+			target:   "/api/actors?q=Tom",
+			header:   http.Header{headerAPIKey: {"wrong"}},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "bearer token",
+			target:   "/api/actors?q=tom%20hardy",
+			header:   http.Header{"Authorization": {"Bearer " + testKey}},
+			wantCode: http.StatusOK,
+			wantIDs:  []int{1514},
+		},
+		{name: "search", target: "/api/actors?q=Tom", wantCode: http.StatusOK, wantIDs: []int{1514, 9144, 2015035}},
+		{name: "search finds nobody", target: "/api/actors?q=Nobody", wantCode: http.StatusOK, wantIDs: []int{}},
+		{name: "search without query", target: "/api/actors?q=%20", wantCode: http.StatusBadRequest},
+		{
+			name:     "filmography",
+			target:   "/api/actors/1514/movies",
+			wantCode: http.StatusOK,
+			wantIDs:  []int{447301, 840152, 716587, 580336},
+		},
+		{
+			name:     "filmography with options",
+			target:   "/api/actors/1514/movies?kind=film&sort=year_desc&min_rating=7.6",
+			wantCode: http.StatusOK,
+			wantIDs:  []int{580336, 447301},
+		},
+		{name: "unknown actor", target: "/api/actors/1/movies", wantCode: http.StatusNotFound},
+		{name: "invalid actor", target: "/api/actors/abc/movies", wantCode: http.StatusBadRequest},
+		{
+			name:     "common movies",
+			target:   "/api/common?actor=1514&actor=8027",
+			wantCode: http.StatusOK,
+			wantIDs:  []int{716587, 840152, 447301},
+		},
+		{
+			name:     "common movies with options",
+			target:   "/api/common?actor=1514&actor=8027&year_from=2011&year_to=2016",
+			wantCode: http.StatusOK,
+			wantIDs:  []int{716587},
+		},
+		{
+			name:      "single actor",
+			target:    "/api/common?actor=1514",
+			wantCode:  http.StatusBadRequest,
+			wantError: "нужно указать от 2 до 5 актеров",
+		},
+		{
+			name:      "duplicate actor",
+			target:    "/api/common?actor=1514&actor=1514",
+			wantCode:  http.StatusBadRequest,
+			wantError: "актер задублирован",
+		},
+		{
+			name:      "unknown sort",
+			target:    "/api/common?actor=1514&actor=8027&sort=name",
+			wantCode:  http.StatusBadRequest,
+			wantError: `неизвестная сортировка "name"`,
+		},
+		{
+			name:      "invalid year",
+			target:    "/api/common?actor=1514&actor=8027&year_to=soon",
+			wantCode:  http.StatusBadRequest,
+			wantError: `неверный year_to "soon"`,
+		},
+		{
+			name:     "kinopoisk unavailable",
+			target:   "/api/common?actor=1514&actor=8027",
+			setup:    func(kp *kinopoisktest.Server) { kp.FailNext(6, http.StatusInternalServerError) },
+			wantCode: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, kp := newTestHandler(t, 0, 1)
+			if tt.setup != nil {
+				tt.setup(kp)
+			}
+			header := tt.header
+			if header == nil && tt.wantCode != http.StatusUnauthorized {
+				header = authorized()
+			}
+
+			rec := get(h, tt.target, header)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d, body %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Header().Get(headerRequestID) == "" {
+				t.Errorf("no %s header", headerRequestID)
+			}
+
+			var body struct {
+				Actors []actor `json:"actors"`
+				Movies []movie `json:"movies"`
+				Error  string  `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if tt.wantError != "" && body.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", body.Error, tt.wantError)
+			}
+			if tt.wantIDs == nil {
+				return
+			}
+			got := make([]int, 0, len(tt.wantIDs))
+			for _, a := range body.Actors {
+				got = append(got, a.ID)
+			}
+			for _, m := range body.Movies {
+				got = append(got, m.ID)
+			}
+			// Actors with equally long filmographies come in no particular order.
+			if body.Actors != nil {
+				slices.Sort(got)
+			}
+			if !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestHandlerRateLimitPerKey(t *testing.T) {
+	h, kp := newTestHandler(t, 0.001, 2)
+
+	for i := range 2 {
+		if rec := get(h, "/api/actors?q=Tom", authorized()); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: code = %d, want %d", i+1, rec.Code, http.StatusOK)
+		}
+	}
+	rec := get(h, "/api/actors?q=Tom", authorized())
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("code = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get(headerRetryAfter) == "" {
+		t.Errorf("no %s header", headerRetryAfter)
+	}
+
+	// The budget of one key does not affect the others.
+	other := http.Header{headerAPIKey: {"other-key"}}
+	if rec = get(h, "/api/actors?q=Tom", other); rec.Code != http.StatusOK {
+		t.Errorf("other key: code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := kp.Count(kinopoisktest.RouteSearch); got != 3 {
+		t.Errorf("kinopoisk requests = %d, want 3", got)
+	}
+}
+
+func TestHandlerOpenAPI(t *testing.T) {
+	h, _ := newTestHandler(t, 0, 1)
+
+	rec := get(h, "/api/openapi.yaml", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/yaml" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if rec.Body.Len() == 0 {
+		t.Error("empty document")
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"KinopoiskTwoActors/pkg/prometheus"
+	"crypto/subtle"
+	"golang.org/x/time/rate"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const (
+	headerAPIKey     = "X-API-Key"
+	headerRetryAfter = "Retry-After"
+)
+
+// client is an API key with its own request budget.
+type client struct {
+	key     string
+	label   string
+	limiter *rate.Limiter
+}
+
+func newClients(keys []string, limit float64, burst int) []*client {
+	every := rate.Inf
+	if limit > 0 {
+		every = rate.Limit(limit)
+	}
+	clients := make([]*client, 0, len(keys))
+	for i, key := range keys {
+		clients = append(clients, &client{
+			key:     key,
+			label:   prometheus.KeyLabel(i),
+			limiter: rate.NewLimiter(every, burst),
+		})
+	}
+	return clients
+}
+
+// authenticate finds the client by the key from the X-API-Key header or the bearer token.
+// Every key is compared in constant time.
+func (h *Handler) authenticate(r *http.Request) *client {
+	key := r.Header.Get(headerAPIKey)
+	if key == "" {
+		key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return nil
+	}
+
+	var found *client
+	for _, c := range h.clients {
+		if subtle.ConstantTimeCompare([]byte(c.key), []byte(key)) == 1 {
+			found = c
+		}
+	}
+	return found
+}
+
+// allow takes a request from the budget of the client. When the budget is exhausted
+// it returns how many seconds to wait.
+func (c *client) allow() (bool, int) {
+	reservation := c.limiter.Reserve()
+	delay := reservation.Delay()
+	if delay == 0 {
+		return true, 0
+	}
+	reservation.Cancel()
+	return false, int(math.Ceil(delay.Seconds()))
+}
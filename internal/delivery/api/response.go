@@ -0,0 +1,103 @@
+package api
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type actor struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	EngName  string `json:"enName,omitempty"`
+	Birthday string `json:"birthday,omitempty"`
+	PhotoURL string `json:"photo,omitempty"`
+	URL      string `json:"url"`
+}
+
+type movie struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	EngName   string  `json:"enName,omitempty"`
+	Year      int     `json:"year,omitempty"`
+	Rating    float32 `json:"rating"`
+	IsSeries  bool    `json:"isSeries"`
+	PosterURL string  `json:"poster,omitempty"`
+	URL       string  `json:"url"`
+}
+
+type actorsResponse struct {
+	Actors []actor `json:"actors"`
+}
+
+type moviesResponse struct {
+	Movies []movie `json:"movies"`
+	// Partial is set when some movies could not be loaded from Kinopoisk.
+	Partial bool `json:"partial"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func toActors(actors []domain.Actor) []actor {
+	out := make([]actor, 0, len(actors))
+	for _, a := range actors {
+		out = append(out, actor{
+			ID:       a.ID,
+			Name:     a.Name,
+			EngName:  a.EngName,
+			Birthday: a.Birthday,
+			PhotoURL: a.PhotoURL,
+			URL:      a.ActorURL,
+		})
+	}
+	return out
+}
+
+func toMovies(movies []domain.Movie) []movie {
+	out := make([]movie, 0, len(movies))
+	for _, m := range movies {
+		out = append(out, movie{
+			ID:        m.ID,
+			Name:      m.Name,
+			EngName:   m.EngName,
+			Year:      m.Year,
+			Rating:    m.Rating,
+			IsSeries:  m.IsSeries,
+			PosterURL: m.PosterURL,
+			URL:       m.MovieURL,
+		})
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, errorResponse{Error: message})
+}
+
+// errorStatus maps errors of the use cases to the response status and message.
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, domain.ErrRecordNotFound):
+		return http.StatusNotFound, "не найдено"
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		return http.StatusServiceUnavailable, "дневной лимит запросов к Кинопоиску исчерпан"
+	case errors.Is(err, domain.ErrRateLimited):
+		return http.StatusServiceUnavailable, "Кинопоиск временно ограничил запросы"
+	case errors.Is(err, domain.ErrUnauthorized), errors.Is(err, domain.ErrUpstreamUnavailable):
+		return http.StatusBadGateway, "Кинопоиск недоступен"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "превышено время ожидания"
+	default:
+		return http.StatusInternalServerError, "внутренняя ошибка"
+	}
+}
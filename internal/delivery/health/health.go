@@ -0,0 +1,94 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	statusOK          = "ok"
+	statusDegraded    = "degraded"
+	statusUnavailable = "unavailable"
+	statusError       = "error"
+)
+
+// Check probes one dependency of the bot. A failing critical check makes the bot not ready,
+// a failing non-critical one only degrades it.
+type Check struct {
+	Name     string
+	Critical bool
+	Probe    func(ctx context.Context) error
+}
+
+type componentStatus struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+type report struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentStatus `json:"components,omitempty"`
+}
+
+// Live answers liveness probes: the process is up and serving HTTP.
+func Live(w http.ResponseWriter, _ *http.Request) {
+	writeReport(w, http.StatusOK, report{Status: statusOK})
+}
+
+// Readiness answers readiness probes with the status of every dependency.
+type Readiness struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// NewReadiness creates the handler. Each probe gets at most timeout to answer.
+func NewReadiness(timeout time.Duration, checks ...Check) *Readiness {
+	return &Readiness{checks: checks, timeout: timeout}
+}
+
+func (h *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	components := make([]componentStatus, len(h.checks))
+	wg := sync.WaitGroup{}
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			components[i] = componentStatus{Status: statusOK, Critical: check.Critical}
+			if err := check.Probe(ctx); err != nil {
+				components[i].Status = statusError
+				components[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	rep := report{Status: statusOK, Components: make(map[string]componentStatus, len(h.checks))}
+	code := http.StatusOK
+	for i, check := range h.checks {
+		component := components[i]
+		rep.Components[check.Name] = component
+		if component.Status == statusOK {
+			continue
+		}
+		if component.Critical {
+			rep.Status = statusUnavailable
+			code = http.StatusServiceUnavailable
+		} else if rep.Status == statusOK {
+			rep.Status = statusDegraded
+		}
+	}
+	writeReport(w, code, rep)
+}
+
+func writeReport(w http.ResponseWriter, code int, rep report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(rep)
+}
@@ -2,50 +2,170 @@ package telegram
 
 import (
 	"KinopoiskTwoActors/configs"
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/internal/usecase"
+	"KinopoiskTwoActors/pkg/logger"
 	"KinopoiskTwoActors/pkg/prometheus"
 	"context"
+	"encoding/json"
+	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log/slog"
 	"net/http"
+	"time"
 )
 
 type Bot struct {
 	*tgbotapi.BotAPI
 	StateProvider
-	ActorProvider
-	FilmProvider
-	log *slog.Logger
+	usecase.ActorProvider
+	usecase.FilmProvider
+	log            *slog.Logger
+	cfg            configs.TelegramConfig
+	sessionCfg     configs.SessionConfig
+	webhookUpdates chan tgbotapi.Update
+	// stopped is closed when Run returns, so the webhook handler stops accepting updates.
+	stopped  chan struct{}
+	endpoint string
+	active   *activeChats
+	// inlineAnswers remembers answers to inline queries while Telegram pages through them.
+	inlineAnswers *inlineMemo
 }
 
 func NewBot(config *configs.Config, userStates StateProvider,
-	actor ActorProvider, film FilmProvider, log *slog.Logger) (*Bot, error) {
+	actor usecase.ActorProvider, film usecase.FilmProvider, log *slog.Logger) (*Bot, error) {
 
-	api, err := tgbotapi.NewBotAPI(config.TG.Token)
+	endpoint := config.TG.APIEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+	api, err := tgbotapi.NewBotAPIWithClient(config.TG.Token, endpoint, &http.Client{
+		Timeout: config.TG.ConnectionTimeout,
+	})
 	if err != nil {
 		return nil, err
 	}
-	api.Client = &http.Client{
-		Timeout: config.TG.ConnectionTimeout,
+
+	return &Bot{
+		BotAPI:         api,
+		StateProvider:  userStates,
+		ActorProvider:  actor,
+		FilmProvider:   film,
+		log:            log,
+		cfg:            config.TG,
+		sessionCfg:     config.Session,
+		webhookUpdates: make(chan tgbotapi.Update, webhookBuffer),
+		stopped:        make(chan struct{}),
+		endpoint:       endpoint,
+		active:         newActiveChats(),
+		inlineAnswers:  newInlineMemo(),
+	}, nil
+}
+
+// Ping checks the Telegram Bot API with getMe. Unlike GetMe it gives up as soon as ctx is done.
+func (b *Bot) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(b.endpoint, b.Token, "getMe"), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
-	return &Bot{api, userStates, actor, film, log}, nil
+	var apiResp tgbotapi.APIResponse
+	if err = json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return err
+	}
+	if !apiResp.Ok {
+		return fmt.Errorf("getMe: %d %s", apiResp.ErrorCode, apiResp.Description)
+	}
+	return nil
 }
 
 func (b *Bot) Run(ctx context.Context) {
+	defer close(b.stopped)
+
+	updates, err := b.updatesChan(ctx)
+	if err != nil {
+		b.log.ErrorContext(ctx, "Ошибка получения обновлений", "mode", b.cfg.Mode, errorKey, err)
+		return
+	}
+
+	d := newDispatcher(b.cfg.Workers, b.cfg.QueueSize, b.handleUpdate, b.log)
+	// Queued and in-flight updates are finished after ctx is done, so handlers must not be canceled with it.
+	d.start(context.WithoutCancel(ctx))
+	defer d.stop()
+
+	go b.runJanitor(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			d.dispatch(ctx, update)
+		}
+	}
+}
+
+func (b *Bot) updatesChan(ctx context.Context) (tgbotapi.UpdatesChannel, error) {
+	if b.cfg.Mode == configs.TelegramModeWebhook {
+		if err := b.setWebhook(ctx); err != nil {
+			return nil, err
+		}
+		return b.webhookUpdates, nil
+	}
+
+	if err := b.deleteWebhook(ctx); err != nil {
+		return nil, err
+	}
 	u := tgbotapi.NewUpdate(0)
-	updates := b.GetUpdatesChan(u)
+	return b.GetUpdatesChan(u), nil
+}
 
-	for update := range updates {
+func (b *Bot) runJanitor(ctx context.Context) {
+	ticker := time.NewTicker(b.sessionCfg.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			b.handleUpdate(ctx, update)
+		case <-ticker.C:
+			b.expireIdleSessions(ctx)
+		}
+	}
+}
+
+func (b *Bot) expireIdleSessions(ctx context.Context) {
+	expired := b.ExpireIdleStates(ctx, b.sessionCfg.IdleTimeout, b.active.has)
+	for chatID, state := range expired {
+		ctx := logger.WithCorrelationID(logger.WithChatID(logger.WithStep(ctx, state.Step), chatID),
+			state.CorrelationID)
+		b.log.InfoContext(ctx, "Сессия завершена по бездействию")
+
+		if state.Step != StepActor && state.Step != StepActorSelect {
+			continue
+		}
+		if err := b.ClearPreviousMedia(ctx, chatID, &state); err != nil {
+			b.log.DebugContext(ctx, "Ошибка очистки медиа", errorKey, err)
 		}
+		b.SendMessage(ctx, chatID, "Поиск отменен из-за бездействия. Введите /start для нового поиска")
 	}
 }
 
 func (b *Bot) Stop(ctx context.Context) {
+	if b.cfg.Mode == configs.TelegramModeWebhook {
+		if err := b.deleteWebhook(ctx); err != nil {
+			b.log.ErrorContext(ctx, "Ошибка удаления webhook", errorKey, err)
+		}
+	}
+
 	ids := b.GetCurrentStatesID(ctx)
 	for _, id := range ids {
 		b.SendMessage(ctx, id, "Соединение разорвано")
@@ -53,6 +173,7 @@ func (b *Bot) Stop(ctx context.Context) {
 }
 
 func (b *Bot) SendMessage(ctx context.Context, chatID int64, text string) {
+	ctx = logger.WithChatID(ctx, chatID)
 	if len(text) > 4000 {
 		text = text[:4000] + "..."
 	}
@@ -68,18 +189,14 @@ func (b *Bot) SendMessage(ctx context.Context, chatID int64, text string) {
 	case err := <-done:
 		if err != nil {
 			prometheus.MessagesSent.WithLabelValues("error").Inc()
-			b.log.Error("Ошибка отправки сообщения в чат",
-				err,
-				"text", text,
-				chatIDKey, chatID,
-				correlationIDKey, ctx.Value(correlationIDKey))
+			b.log.ErrorContext(ctx, "Ошибка отправки сообщения в чат",
+				errorKey, err,
+				"text", text)
 		} else {
 			prometheus.MessagesSent.WithLabelValues("ok").Inc()
 		}
 	case <-ctx.Done():
-		b.log.Error("Ошибка отправки сообщения в чат: context timeout",
-			chatIDKey, chatID,
-			correlationIDKey, ctx.Value(correlationIDKey))
+		b.log.ErrorContext(ctx, "Ошибка отправки сообщения в чат: context timeout")
 	}
 
 }
@@ -96,15 +213,14 @@ func (b *Bot) DeleteMessage(chatID int64, messageID int) error {
 	return err
 }
 
-func (b *Bot) ClearPreviousMedia(ctx context.Context, chatID int64) error {
-	state := b.GetStateByID(ctx, chatID)
-	b.log.Debug("Очистка предыдущих медиа", chatIDKey, chatID,
-		correlationIDKey, ctx.Value(correlationIDKey))
+func (b *Bot) ClearPreviousMedia(ctx context.Context, chatID int64,
+	state *domain.SessionState) error {
+	ctx = logger.WithChatID(ctx, chatID)
+	b.log.DebugContext(ctx, "Очистка предыдущих медиа")
 
 	for _, msgID := range state.SentMediaMessages {
 		if err := b.DeleteMessage(chatID, msgID); err != nil {
-			b.log.Debug("Ошибка удаления сообщения", "msgID", msgID, chatIDKey, chatID,
-				correlationIDKey, ctx.Value(correlationIDKey))
+			b.log.DebugContext(ctx, "Ошибка удаления сообщения", "msgID", msgID)
 		}
 	}
 	state.SentMediaMessages = nil
@@ -0,0 +1,123 @@
+package telegram
+
+import (
+	"KinopoiskTwoActors/pkg/prometheus"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"strconv"
+	"sync"
+)
+
+// dispatcher processes updates concurrently. Updates are sharded by chat ID,
+// so updates from the same chat are always handled by the same worker in order.
+type dispatcher struct {
+	queues []chan tgbotapi.Update
+	handle func(ctx context.Context, update tgbotapi.Update)
+	log    *slog.Logger
+	wg     sync.WaitGroup
+}
+
+func newDispatcher(workers int, queueSize int,
+	handle func(ctx context.Context, update tgbotapi.Update), log *slog.Logger) *dispatcher {
+	queues := make([]chan tgbotapi.Update, workers)
+	for i := range queues {
+		queues[i] = make(chan tgbotapi.Update, queueSize)
+	}
+	return &dispatcher{
+		queues: queues,
+		handle: handle,
+		log:    log,
+	}
+}
+
+func (d *dispatcher) start(ctx context.Context) {
+	for i, queue := range d.queues {
+		d.wg.Add(1)
+		go d.work(ctx, strconv.Itoa(i), queue)
+	}
+}
+
+func (d *dispatcher) dispatch(ctx context.Context, update tgbotapi.Update) {
+	shard := shardKey(update) % int64(len(d.queues))
+	if shard < 0 {
+		shard = -shard
+	}
+	queue := d.queues[shard]
+
+	select {
+	case queue <- update:
+		prometheus.UpdateQueueDepth.WithLabelValues(strconv.FormatInt(shard, 10)).
+			Set(float64(len(queue)))
+	case <-ctx.Done():
+	}
+}
+
+// stop closes the queues and waits until the workers drain them.
+func (d *dispatcher) stop() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+func (d *dispatcher) work(ctx context.Context, worker string, queue chan tgbotapi.Update) {
+	defer d.wg.Done()
+	for update := range queue {
+		prometheus.UpdateQueueDepth.WithLabelValues(worker).Set(float64(len(queue)))
+		d.safeHandle(ctx, worker, update)
+	}
+}
+
+func (d *dispatcher) safeHandle(ctx context.Context, worker string, update tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.log.ErrorContext(ctx, "Паника при обработке обновления",
+				"worker", worker,
+				"update_id", update.UpdateID,
+				"panic", r)
+		}
+	}()
+	d.handle(ctx, update)
+}
+
+func shardKey(update tgbotapi.Update) int64 {
+	if chat := update.FromChat(); chat != nil {
+		return chat.ID
+	}
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// activeChats counts the updates being handled per chat, so idle sessions
+// are not expired while a handler is still working with them.
+type activeChats struct {
+	mu    sync.Mutex
+	chats map[int64]int
+}
+
+func newActiveChats() *activeChats {
+	return &activeChats{chats: make(map[int64]int)}
+}
+
+func (a *activeChats) begin(chatID int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.chats[chatID]++
+}
+
+func (a *activeChats) end(chatID int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.chats[chatID]--; a.chats[chatID] <= 0 {
+		delete(a.chats, chatID)
+	}
+}
+
+func (a *activeChats) has(chatID int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.chats[chatID] > 0
+}
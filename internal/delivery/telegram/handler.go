@@ -2,49 +2,91 @@ package telegram
 
 import (
 	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/pkg/logger"
 	"KinopoiskTwoActors/pkg/prometheus"
+	"KinopoiskTwoActors/pkg/tracing"
 	"context"
+	"errors"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
 const (
-	StepFirstActor        = "first_actor"
-	StepFirstActorSelect  = "first_actor_select"
-	StepSecondActor       = "second_actor"
-	StepSecondActorSelect = "second_actor_select"
-	StepCompleted         = "completed"
-	correlationIDKey      = "correlation_id"
-	chatIDKey             = "chat_id"
-	commandKey            = "command"
-	errorKey              = "error"
-	successKey            = "success"
-	queryKey              = "query"
-	delay                 = time.Millisecond * 100
+	StepActor         = "actor"
+	StepActorSelect   = "actor_select"
+	StepCompleted     = "completed"
+	commandKey        = "command"
+	errorKey          = "error"
+	successKey        = "success"
+	queryKey          = "query"
+	delay             = time.Millisecond * 100
+	maxActors         = 5
+	callbackActor     = "actor"
+	callbackSearch    = "search"
+	callbackSeparator = ":"
 )
 
 func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	chatID := shardKey(update)
+	ctx, span := tracing.Start(ctx, "telegram.handleUpdate",
+		attribute.Int(logger.UpdateIDKey, update.UpdateID),
+		attribute.Int64(logger.ChatIDKey, chatID),
+		attribute.String("update_type", updateType(update)))
+	defer span.End()
+	ctx = logger.WithChatID(logger.WithUpdateID(ctx, update.UpdateID), chatID)
+	b.active.begin(chatID)
+	defer b.active.end(chatID)
+
 	switch {
 	case update.CallbackQuery != nil:
 		b.handleCallback(ctx, update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Data,
 			update.CallbackQuery.ID, update.CallbackQuery.Message.MessageID)
 
-	case update.Message.IsCommand():
-		b.handleCommand(ctx, update.Message.Chat.ID, update.Message.Command(),
-			update.Message.CommandArguments())
+	case update.InlineQuery != nil:
+		b.handleInlineQuery(ctx, update.InlineQuery)
 
 	case update.Message == nil:
 		return
 
+	case update.Message.IsCommand():
+		b.handleCommand(ctx, update.Message.Chat.ID, update.Message.Command(),
+			update.Message.CommandArguments())
+
 	default:
-		b.HandleSearchByTwoActors(ctx, update.Message.Chat.ID,
+		b.HandleActorSearch(ctx, update.Message.Chat.ID,
 			strings.TrimSpace(update.Message.Text))
 	}
 }
 
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.CallbackQuery != nil:
+		return "callback"
+	case update.InlineQuery != nil:
+		return "inline_query"
+	case update.Message == nil:
+		return "other"
+	case update.Message.IsCommand():
+		return "command"
+	default:
+		return "message"
+	}
+}
+
+// withCorrelationID puts the session correlation ID into ctx and onto the update span,
+// so traces can be found by the correlation_id of the logs.
+func (b *Bot) withCorrelationID(ctx context.Context, chatID int64) context.Context {
+	correlationID := b.GetCorrelationID(ctx, chatID)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(logger.CorrelationIDKey, correlationID))
+	return logger.WithCorrelationID(ctx, correlationID)
+}
+
 func (b *Bot) handleCommand(ctx context.Context, chatID int64, command string, query string) {
 	startTime := time.Now()
 	defer func() {
@@ -56,11 +98,10 @@ func (b *Bot) handleCommand(ctx context.Context, chatID int64, command string, q
 		prometheus.CommandCounter.WithLabelValues(command, status).Inc()
 	}()
 
-	ctx = context.WithValue(ctx, correlationIDKey, b.GetCorrelationID(ctx, chatID))
+	ctx = b.withCorrelationID(ctx, chatID)
 
-	b.log.Info(
-		"Команда получена", chatIDKey, chatID, commandKey, command, queryKey, query,
-		correlationIDKey, ctx.Value(correlationIDKey))
+	b.log.InfoContext(ctx,
+		"Команда получена", commandKey, command, queryKey, query)
 
 	switch command {
 	case "start":
@@ -74,24 +115,21 @@ func (b *Bot) handleCommand(ctx context.Context, chatID int64, command string, q
 }
 
 func (b *Bot) handleStart(ctx context.Context, chatID int64) {
-	state := b.GetStateByID(ctx, chatID)
-	*state = domain.SessionState{
-		Step: StepFirstActor,
-	}
-	err := b.SetState(ctx, chatID, state)
+	// Only /start creates a session, keeping the correlation ID already written to the logs.
+	err := b.SetState(ctx, chatID, &domain.SessionState{
+		Step:          StepActor,
+		CorrelationID: logger.CorrelationID(ctx),
+	})
 	if err != nil {
-		b.log.Error(
+		b.log.ErrorContext(ctx,
 			"Ошибка задания шага",
-			chatIDKey, chatID,
-			correlationIDKey, ctx.Value(correlationIDKey),
 			errorKey, err)
 	}
-	prometheus.ActiveUsers.Inc()
 	b.SendMessage(ctx, chatID, "Введите имя первого актера")
 }
 
 func (b *Bot) handleHelp(ctx context.Context, chatID int64) {
-	b.SendMessage(ctx, chatID, "Бот позволяет найти общие фильмы для двух актеров.\n"+
+	b.SendMessage(ctx, chatID, "Бот позволяет найти общие фильмы для двух и более актеров.\n"+
 		"Для начала поиска нажмите /start")
 }
 
@@ -99,14 +137,16 @@ func (b *Bot) handleUnknown(ctx context.Context, chatID int64) {
 	b.SendMessage(ctx, chatID, "Неизвестная команда.\nВведите /start для нового поиска")
 }
 
-func (b *Bot) HandleSearchByTwoActors(ctx context.Context, chatID int64, query string) {
+func (b *Bot) HandleActorSearch(ctx context.Context, chatID int64, query string) {
+	ctx = b.withCorrelationID(ctx, chatID)
 	state := b.GetStateByID(ctx, chatID)
+	step := state.Step
+	ctx = logger.WithStep(ctx, step)
 	startTime := time.Now()
 	defer func() {
-		prometheus.CommandDuration.WithLabelValues(state.Step).Observe(time.Since(startTime).
+		prometheus.CommandDuration.WithLabelValues(step).Observe(time.Since(startTime).
 			Seconds())
 	}()
-	ctx = context.WithValue(ctx, correlationIDKey, b.GetCorrelationID(ctx, chatID))
 
 	status := successKey
 	defer func() {
@@ -114,70 +154,47 @@ func (b *Bot) HandleSearchByTwoActors(ctx context.Context, chatID int64, query s
 	}()
 
 	switch state.Step {
-	case StepFirstActor, StepSecondActor:
-		err := b.handleActor(ctx, chatID, query)
+	case StepActor:
+		err := b.handleActor(ctx, chatID, state, query)
 		if err != nil {
 			status = errorKey
-			b.log.Error(
+			b.log.ErrorContext(ctx,
 				"Ошибка обработки поиска актера",
-				chatIDKey, chatID,
 				queryKey, query,
-				correlationIDKey, ctx.Value(correlationIDKey),
 				errorKey, err)
-			b.ResetUserState(ctx, chatID)
-			b.SendMessage(ctx, chatID, "Произошла ошибка поиска. Введите /start для нового поиска")
+			b.resetState(ctx, chatID, state)
+			b.SendMessage(ctx, chatID, searchErrorText(err))
+			return
 		}
-		b.log.Info(
-			"Актеры успешно отправлены на выбор",
-			chatIDKey, chatID,
-			queryKey, query,
-			correlationIDKey, ctx.Value(correlationIDKey),
-		)
+		b.saveState(ctx, chatID, state)
+		b.log.InfoContext(ctx, "Актеры успешно отправлены на выбор", queryKey, query)
 	default:
 		b.SendMessage(ctx, chatID, "Введите /start для нового поиска")
-		b.log.Debug(
-			"Ошибка шага",
-			chatIDKey, chatID,
-			"state.Step", state.Step,
-			queryKey, query,
-			correlationIDKey, ctx.Value(correlationIDKey),
-		)
+		b.log.DebugContext(ctx, "Ошибка шага", queryKey, query)
 	}
 }
 
-func (b *Bot) handleActor(ctx context.Context, chatID int64, query string) error {
+func (b *Bot) handleActor(ctx context.Context, chatID int64, state *domain.SessionState,
+	query string) error {
 	const op = "BotHandler.handleActor"
 
-	state := b.GetStateByID(ctx, chatID)
-
 	actors, err := b.SearchActor(ctx, query)
 	if err != nil {
 		return fmt.Errorf("%s: Ошибка поиска актера %s: %w", op, query, err)
 	}
 
 	if len(actors) == 0 {
-		b.log.Info("Актеры не найдены", chatIDKey, chatID, queryKey, query, correlationIDKey,
-			ctx.Value(correlationIDKey))
+		b.log.InfoContext(ctx, "Актеры не найдены", queryKey, query)
 		return fmt.Errorf("%s: Актеры по запросу \"%s\"не найдены", op, query)
 	}
 
-	state.TempActors = b.createPhotoData(actors)
+	state.TempActors = b.createPhotoData(ctx, actors)
 
-	if state.Step == StepFirstActor {
-		state.Step = StepFirstActorSelect
-	} else if state.Step == StepSecondActor {
-		state.Step = StepSecondActorSelect
-	} else {
-		state.Step = StepCompleted
-	}
+	state.Step = StepActorSelect
 
-	b.log.Debug("Подготовлены к отправке на выбор:",
-		"state.TempActors", state.TempActors,
-		chatIDKey, chatID,
-		correlationIDKey, ctx.Value(correlationIDKey),
-	)
+	b.log.DebugContext(ctx, "Подготовлены к отправке на выбор:", "state.TempActors", state.TempActors)
 
-	err = b.sendActors(ctx, chatID, state.TempActors)
+	err = b.sendActors(ctx, chatID, state)
 	if err != nil {
 		return fmt.Errorf("%s: Ошибка отправки актеров на выбор %s: %w", op, query, err)
 	}
@@ -185,15 +202,17 @@ func (b *Bot) handleActor(ctx context.Context, chatID int64, query string) error
 	return nil
 }
 
-func (b *Bot) sendActors(ctx context.Context, chatID int64, actors []domain.PhotoData) error {
+func (b *Bot) sendActors(ctx context.Context, chatID int64, state *domain.SessionState) error {
 	const op = "BotHandler.sendActors"
 
 	b.SendMessage(ctx, chatID, "Найдены")
 
-	for _, photo := range actors {
-		if _, err := b.SendActorWithPhoto(ctx, chatID, photo); err != nil {
+	for _, photo := range state.TempActors {
+		msgID, err := b.SendActorWithPhoto(ctx, chatID, photo)
+		if err != nil {
 			return fmt.Errorf("%s: ошибка отправки фото в чат %d: %v", op, chatID, err)
 		}
+		state.SentMediaMessages = append(state.SentMediaMessages, msgID)
 		time.Sleep(delay)
 	}
 
@@ -207,7 +226,7 @@ func (b *Bot) SendActorWithPhoto(ctx context.Context, chatID int64,
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonURL("Ссылка", photo.ActorURL),
 			tgbotapi.NewInlineKeyboardButtonData("Выбрать",
-				strconv.Itoa(photo.ID)),
+				callbackActor+callbackSeparator+strconv.Itoa(photo.ID)),
 		),
 	)
 	data.Caption = photo.Caption
@@ -215,65 +234,123 @@ func (b *Bot) SendActorWithPhoto(ctx context.Context, chatID int64,
 	if err != nil {
 		return 0, err
 	}
-	state := b.GetStateByID(ctx, chatID)
-	state.SentMediaMessages = append(state.SentMediaMessages, sentMsg.MessageID)
 	return sentMsg.MessageID, nil
 }
 
-func (b *Bot) handleActorSelection(ctx context.Context, chatID int64, actorID int) {
-	state := b.GetStateByID(ctx, chatID)
-	if err := b.ClearPreviousMedia(ctx, chatID); err != nil {
-		b.log.Error("Ошибка очистки медиа", err, chatIDKey, chatID, correlationIDKey,
-			ctx.Value(correlationIDKey))
+func (b *Bot) handleActorSelection(ctx context.Context, chatID int64, state *domain.SessionState,
+	actorID int) {
+	if err := b.ClearPreviousMedia(ctx, chatID, state); err != nil {
+		b.log.ErrorContext(ctx, "Ошибка очистки медиа", errorKey, err)
 	}
 
-	switch state.Step {
-	case StepFirstActorSelect:
-		state.FirstActorID = actorID
-		state.Step = StepSecondActor
-		b.SendMessage(ctx, chatID, "Введите имя второго актера:")
+	if state.Step != StepActorSelect {
+		b.SendMessage(ctx, chatID, "Неверный выбор. Введите /start")
+		return
+	}
 
-	case StepSecondActorSelect:
-		state.SecondActorID = actorID
-		state.Step = StepCompleted
-		err := b.handleCommonMovies(ctx, chatID, state)
-		if err != nil {
-			b.ResetUserState(ctx, chatID)
-			b.log.Error("Ошибка обработки вывода фильмов", err, chatIDKey, chatID,
-				correlationIDKey, ctx.Value(correlationIDKey))
-		}
+	if slices.Contains(state.ActorIDs, actorID) {
+		state.Step = StepActor
+		b.SendMessage(ctx, chatID, "Этот актер уже выбран. Введите имя другого актера:")
+		return
+	}
+	state.ActorIDs = append(state.ActorIDs, actorID)
+
+	switch {
+	case len(state.ActorIDs) == 1:
+		state.Step = StepActor
+		b.SendMessage(ctx, chatID, "Введите имя второго актера:")
+	case len(state.ActorIDs) >= maxActors:
+		b.searchCommonMovies(ctx, chatID, state)
 	default:
+		state.Step = StepActor
+		if err := b.sendNextActorPrompt(ctx, chatID, state); err != nil {
+			b.log.ErrorContext(ctx, "Ошибка отправки предложения начать поиск", errorKey, err)
+		}
+	}
+}
+
+func (b *Bot) handleSearchSelection(ctx context.Context, chatID int64, state *domain.SessionState) {
+	if state.Step != StepActor || len(state.ActorIDs) < 2 {
 		b.SendMessage(ctx, chatID, "Неверный выбор. Введите /start")
+		return
+	}
+	if err := b.ClearPreviousMedia(ctx, chatID, state); err != nil {
+		b.log.ErrorContext(ctx, "Ошибка очистки медиа", errorKey, err)
+	}
+	b.searchCommonMovies(ctx, chatID, state)
+}
+
+func (b *Bot) searchCommonMovies(ctx context.Context, chatID int64, state *domain.SessionState) {
+	state.Step = StepCompleted
+	err := b.handleCommonMovies(ctx, chatID, state)
+	if err != nil {
+		b.resetState(ctx, chatID, state)
+		b.log.ErrorContext(ctx, "Ошибка обработки вывода фильмов", errorKey, err)
+		b.SendMessage(ctx, chatID, searchErrorText(err))
 	}
 }
+
+func (b *Bot) sendNextActorPrompt(ctx context.Context, chatID int64,
+	state *domain.SessionState) error {
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(
+		"Выбрано актеров: %d.\nВведите имя следующего актера или начните поиск",
+		len(state.ActorIDs)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Готово, искать", callbackSearch),
+		),
+	)
+	sentMsg, err := b.Send(msg)
+	if err != nil {
+		return err
+	}
+	state.SentMediaMessages = append(state.SentMediaMessages, sentMsg.MessageID)
+	return nil
+}
+
 func (b *Bot) handleCallback(ctx context.Context, chatID int64, data string, callbackID string,
 	callbackMessageID int) {
-	const op = "BotHandler.handleCallback"
-	actorID, err := strconv.Atoi(data)
+	ctx = b.withCorrelationID(ctx, chatID)
+	state := b.GetStateByID(ctx, chatID)
+	ctx = logger.WithStep(ctx, state.Step)
+
+	var answerText string
+	action, payload, _ := strings.Cut(data, callbackSeparator)
+	switch action {
+	case callbackActor:
+		b.handleActorCallback(ctx, chatID, state, payload, callbackMessageID)
+	case callbackSearch:
+		b.log.InfoContext(ctx, "Запрошен поиск общих фильмов")
+		b.handleSearchSelection(ctx, chatID, state)
+	case callbackPage:
+		answerText = b.handlePageCallback(ctx, chatID, state, payload, callbackMessageID)
+	case callbackOption:
+		answerText = b.handleOptionCallback(ctx, chatID, state, payload, callbackMessageID)
+	default:
+		b.log.ErrorContext(ctx, "Неизвестный callback", "data", data)
+		b.SendMessage(ctx, chatID, "Произошла ошибка поиска. Введите /start для нового поиска")
+		b.resetState(ctx, chatID, state)
+	}
+	b.saveState(ctx, chatID, state)
+
+	if err := b.AnswerCallbackQuery(callbackID, answerText); err != nil {
+		b.log.DebugContext(ctx, "Ошибка ответа на callback", errorKey, err)
+	}
+}
+
+func (b *Bot) handleActorCallback(ctx context.Context, chatID int64, state *domain.SessionState,
+	payload string, callbackMessageID int) {
+	actorID, err := strconv.Atoi(payload)
 	if err != nil {
-		b.log.Error(
+		b.log.ErrorContext(ctx,
 			"Ошибка конвертации ID актера",
-			chatIDKey, chatID,
-			correlationIDKey, ctx.Value(correlationIDKey),
 			errorKey, err)
 		b.SendMessage(ctx, chatID, "Произошла ошибка поиска. Введите /start для нового поиска")
-		b.ResetUserState(ctx, chatID)
+		b.resetState(ctx, chatID, state)
 		return
 	}
-	ctx = context.WithValue(ctx, correlationIDKey, b.GetCorrelationID(ctx, chatID))
-	b.log.Info("Выбран актер", "actorID", actorID, chatIDKey, chatID, correlationIDKey,
-		ctx.Value(correlationIDKey))
-	b.handleActorSelection(ctx, chatID, actorID)
-	var answerText string
-	//if err != nil {
-	//	answerText = "Ошибка выбора актера"
-	//	log.Printf("Error selecting actor: %v", err)
-	//
-	//}
-	err = b.AnswerCallbackQuery(callbackID, answerText)
-	//if err != nil {
-	//
-	//}
+	b.log.InfoContext(ctx, "Выбран актер", "actorID", actorID)
+	b.handleActorSelection(ctx, chatID, state, actorID)
 
 	editMsg := tgbotapi.NewEditMessageReplyMarkup(
 		chatID,
@@ -290,31 +367,30 @@ func (b *Bot) handleCallback(ctx context.Context, chatID int64, data string, cal
 
 func (b *Bot) handleCommonMovies(ctx context.Context, chatID int64, state *domain.SessionState) error {
 
-	commonMovies, err := b.GetCommonMovies(ctx, state.FirstActorID, state.SecondActorID)
+	commonMovies, err := b.GetCommonMovies(ctx, state.ActorIDs, domain.MovieOptions{})
 
-	if err != nil {
+	if errors.Is(err, domain.ErrPartialResult) {
+		b.log.WarnContext(ctx, "Часть фильмов не загружена",
+			errorKey, err)
+		b.SendMessage(ctx, chatID, "Не удалось загрузить часть фильмов, список может быть неполным")
+	} else if err != nil {
 		return err
 	}
 
 	if len(commonMovies) == 0 {
 		b.SendMessage(ctx, chatID, "У актеров нет общих фильмов")
-	} else if len(commonMovies) > 10 {
-		b.SendMessage(ctx, chatID, "Общих фильмов больше 10")
+		b.resetState(ctx, chatID, state)
 	} else {
-		msg := fmt.Sprintf("Общие фильмы:")
-		b.SendMessage(ctx, chatID, msg)
-
-		for _, movie := range commonMovies {
-			b.SendMovie(chatID, movie)
+		state.Movies = commonMovies
+		state.Page = 0
+		if err = b.sendMoviesPage(ctx, chatID, state); err != nil {
+			return err
 		}
-
 	}
-	b.ResetUserState(ctx, chatID)
-	prometheus.ActiveUsers.Dec()
 	return nil
 }
 
-func (b *Bot) createPhotoData(actors []domain.Actor) []domain.PhotoData {
+func (b *Bot) createPhotoData(ctx context.Context, actors []domain.Actor) []domain.PhotoData {
 	if len(actors) == 0 {
 		return nil
 	}
@@ -326,7 +402,7 @@ func (b *Bot) createPhotoData(actors []domain.Actor) []domain.PhotoData {
 			var err error
 			birthday, err = time.Parse(time.RFC3339, actor.Birthday)
 			if err != nil {
-				b.log.Debug("Ошибка парсинга даты", err, "actor.Birthday", actor.Birthday)
+				b.log.DebugContext(ctx, "Ошибка парсинга даты", errorKey, err, "actor.Birthday", actor.Birthday)
 			}
 		}
 		photo := domain.PhotoData{
@@ -340,18 +416,29 @@ func (b *Bot) createPhotoData(actors []domain.Actor) []domain.PhotoData {
 	return response
 }
 
-func (b *Bot) SendMovie(chatID int64, movie domain.Movie) error {
-	const op = "BotHandler.sendMovie"
+func searchErrorText(err error) string {
+	switch {
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		return "Дневной лимит запросов к Кинопоиску исчерпан. Попробуйте завтра"
+	case errors.Is(err, domain.ErrRateLimited):
+		return "Кинопоиск временно ограничил запросы. Попробуйте через минуту, введите /start"
+	default:
+		return "Произошла ошибка поиска. Введите /start для нового поиска"
+	}
+}
 
-	data := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(movie.PosterURL))
-	data.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonURL("Ссылка", movie.MovieURL),
-		),
-	)
-	caption := fmt.Sprintf("%s (%s) %d, Рейтинг: %.1f", movie.Name, movie.EngName, movie.Year, movie.Rating)
+// saveState persists the session unless it has been reset while handling the update.
+func (b *Bot) saveState(ctx context.Context, chatID int64, state *domain.SessionState) {
+	if state.Step == "" {
+		return
+	}
+	if err := b.SetState(ctx, chatID, state); err != nil {
+		b.log.ErrorContext(ctx, "Ошибка сохранения состояния",
+			errorKey, err)
+	}
+}
 
-	data.Caption = caption
-	_, err := b.Send(data)
-	return err
+func (b *Bot) resetState(ctx context.Context, chatID int64, state *domain.SessionState) {
+	*state = domain.SessionState{}
+	b.ResetUserState(ctx, chatID)
 }
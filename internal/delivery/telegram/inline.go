@@ -0,0 +1,273 @@
+package telegram
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/pkg/logger"
+	"KinopoiskTwoActors/pkg/prometheus"
+	"context"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	commandInline = "inline"
+	// inlinePageSize is the number of results in one answer, Telegram accepts up to 50.
+	inlinePageSize = 20
+	// inlineErrorCacheTime is the cache time in seconds of failed searches, so they are retried soon.
+	inlineErrorCacheTime = 1
+	inlineSeparator      = "+"
+	// inlineStartParameter is passed to /start when the user opens the bot from inline results.
+	inlineStartParameter = "inline"
+	// inlineMemoSize bounds the number of remembered answers.
+	inlineMemoSize = 1000
+)
+
+// inlineAnswer is the answer to an inline query before it is split into pages.
+type inlineAnswer struct {
+	results []any
+	// hint is shown above the results as a button opening the bot.
+	hint      string
+	cacheTime int
+}
+
+// handleInlineQuery answers "@bot name" with the found actors and "@bot name + name" with their common movies.
+func (b *Bot) handleInlineQuery(ctx context.Context, query *tgbotapi.InlineQuery) {
+	startTime := time.Now()
+	defer func() {
+		prometheus.CommandDuration.WithLabelValues(commandInline).Observe(time.Since(startTime).Seconds())
+	}()
+
+	ctx = logger.WithCorrelationID(ctx, query.ID)
+	b.log.InfoContext(ctx, "Inline запрос получен", queryKey, query.Query, "offset", query.Offset)
+
+	// Telegram asks for every next page with the same query, so the answer is computed
+	// once and only sliced per offset.
+	names := splitInlineQuery(query.Query)
+	key := inlineQueryKey(names)
+	answer, ok := b.inlineAnswers.get(key, time.Now())
+	var err error
+	if !ok {
+		answer, err = b.inlineAnswer(ctx, names)
+		if err == nil {
+			b.inlineAnswers.set(key, answer, time.Now())
+		}
+	}
+	status := successKey
+	if err != nil {
+		status = errorKey
+		b.log.ErrorContext(ctx, "Ошибка inline поиска", queryKey, query.Query, errorKey, err)
+		answer = inlineAnswer{hint: inlineErrorText(err), cacheTime: inlineErrorCacheTime}
+	}
+	prometheus.CommandCounter.WithLabelValues(commandInline, status).Inc()
+
+	results, nextOffset := inlinePage(answer.results, query.Offset)
+	config := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       results,
+		CacheTime:     answer.cacheTime,
+		NextOffset:    nextOffset,
+	}
+	if answer.hint != "" {
+		config.SwitchPMText = answer.hint
+		config.SwitchPMParameter = inlineStartParameter
+	}
+	if _, err := b.Request(config); err != nil {
+		b.log.ErrorContext(ctx, "Ошибка ответа на inline запрос", errorKey, err)
+	}
+}
+
+func (b *Bot) inlineAnswer(ctx context.Context, names []string) (inlineAnswer, error) {
+	answer := inlineAnswer{cacheTime: int(b.cfg.InlineCacheTime.Seconds())}
+	switch {
+	case len(names) == 0:
+		answer.hint = "Введите имя актера или несколько имен через +"
+		return answer, nil
+	case len(names) > maxActors:
+		answer.hint = fmt.Sprintf("Можно указать не больше %d актеров", maxActors)
+		return answer, nil
+	case len(names) == 1:
+		actors, err := b.SearchActor(ctx, names[0])
+		// Search drops actors without a photo or a name, so it may find nobody without an error.
+		if errors.Is(err, domain.ErrRecordNotFound) || err == nil && len(actors) == 0 {
+			answer.hint = "Актер не найден"
+			return answer, nil
+		}
+		if err != nil {
+			return inlineAnswer{}, err
+		}
+		answer.results = b.actorResults(ctx, actors)
+		return answer, nil
+	}
+
+	actors := make([]domain.Actor, 0, len(names))
+	for _, name := range names {
+		found, err := b.SearchActor(ctx, name)
+		if errors.Is(err, domain.ErrRecordNotFound) || err == nil && len(found) == 0 {
+			answer.hint = fmt.Sprintf("Актер %q не найден", name)
+			return answer, nil
+		}
+		if err != nil {
+			return inlineAnswer{}, err
+		}
+		// There is no way to ask which namesake was meant, so the best match is used.
+		if slices.ContainsFunc(actors, func(actor domain.Actor) bool { return actor.ID == found[0].ID }) {
+			answer.hint = "Этот актер уже указан"
+			return answer, nil
+		}
+		actors = append(actors, found[0])
+	}
+
+	actorIDs := make([]int, 0, len(actors))
+	for _, actor := range actors {
+		actorIDs = append(actorIDs, actor.ID)
+	}
+	movies, err := b.GetCommonMovies(ctx, actorIDs, domain.MovieOptions{})
+	if errors.Is(err, domain.ErrPartialResult) {
+		b.log.WarnContext(ctx, "Список общих фильмов неполный", errorKey, err)
+		answer.cacheTime = inlineErrorCacheTime
+	} else if err != nil {
+		return inlineAnswer{}, err
+	}
+	if len(movies) == 0 {
+		answer.hint = "У актеров нет общих фильмов"
+		return answer, nil
+	}
+	answer.results = movieResults(movies, actorNames(actors))
+	return answer, nil
+}
+
+func (b *Bot) actorResults(ctx context.Context, actors []domain.Actor) []any {
+	results := make([]any, 0, len(actors))
+	for _, photo := range b.createPhotoData(ctx, actors) {
+		text := fmt.Sprintf("<a href=\"%s\">%s</a>", photo.ActorURL, html.EscapeString(photo.Caption))
+		result := tgbotapi.NewInlineQueryResultArticleHTML("actor:"+strconv.Itoa(photo.ID), photo.Caption, text)
+		result.Description = "Добавьте « + имя», чтобы найти общие фильмы"
+		result.URL = photo.ActorURL
+		result.HideURL = true
+		result.ThumbURL = photo.PhotoURL
+		results = append(results, result)
+	}
+	return results
+}
+
+func movieResults(movies []domain.Movie, actors string) []any {
+	results := make([]any, 0, len(movies))
+	for _, movie := range movies {
+		text := formatMovie(movie) + "\n" + html.EscapeString(actors)
+		result := tgbotapi.NewInlineQueryResultArticleHTML("movie:"+strconv.Itoa(movie.ID), movie.Name, text)
+		result.Description = fmt.Sprintf("%d, Рейтинг: %.1f", movie.Year, movie.Rating)
+		if movie.IsSeries {
+			result.Description += ", сериал"
+		}
+		result.URL = movie.MovieURL
+		result.HideURL = true
+		result.ThumbURL = movie.PosterURL
+		results = append(results, result)
+	}
+	return results
+}
+
+// inlinePage returns the page of results starting at offset and the offset of the next page,
+// which is empty on the last page.
+func inlinePage(results []any, offset string) ([]any, string) {
+	start, _ := strconv.Atoi(offset)
+	start = max(0, min(start, len(results)))
+	end := min(start+inlinePageSize, len(results))
+
+	nextOffset := ""
+	if end < len(results) {
+		nextOffset = strconv.Itoa(end)
+	}
+	// Telegram rejects a missing list of results, so the page is never nil.
+	return append(make([]any, 0, end-start), results[start:end]...), nextOffset
+}
+
+// splitInlineQuery returns the actor names separated by "+".
+func splitInlineQuery(query string) []string {
+	names := make([]string, 0, 2)
+	for _, name := range strings.Split(query, inlineSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// inlineQueryKey identifies the query regardless of case and extra spaces.
+func inlineQueryKey(names []string) string {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, strings.ToLower(strings.Join(strings.Fields(name), " ")))
+	}
+	return strings.Join(keys, inlineSeparator)
+}
+
+type inlineMemoEntry struct {
+	answer  inlineAnswer
+	expires time.Time
+}
+
+// inlineMemo keeps computed answers for as long as Telegram is told to cache them.
+type inlineMemo struct {
+	mu      sync.Mutex
+	answers map[string]inlineMemoEntry
+}
+
+func newInlineMemo() *inlineMemo {
+	return &inlineMemo{answers: make(map[string]inlineMemoEntry)}
+}
+
+func (m *inlineMemo) get(key string, now time.Time) (inlineAnswer, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.answers[key]
+	if !ok || !now.Before(entry.expires) {
+		return inlineAnswer{}, false
+	}
+	return entry.answer, true
+}
+
+func (m *inlineMemo) set(key string, answer inlineAnswer, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.answers) >= inlineMemoSize {
+		for k, entry := range m.answers {
+			if !now.Before(entry.expires) {
+				delete(m.answers, k)
+			}
+		}
+		if len(m.answers) >= inlineMemoSize {
+			return
+		}
+	}
+	m.answers[key] = inlineMemoEntry{
+		answer:  answer,
+		expires: now.Add(time.Duration(answer.cacheTime) * time.Second),
+	}
+}
+
+func actorNames(actors []domain.Actor) string {
+	names := make([]string, 0, len(actors))
+	for _, actor := range actors {
+		names = append(names, actor.Name)
+	}
+	return "Общие фильмы: " + strings.Join(names, ", ")
+}
+
+func inlineErrorText(err error) string {
+	switch {
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		return "Дневной лимит запросов к Кинопоиску исчерпан"
+	case errors.Is(err, domain.ErrRateLimited):
+		return "Кинопоиск ограничил запросы, попробуйте через минуту"
+	default:
+		return "Ошибка поиска, попробуйте еще раз"
+	}
+}
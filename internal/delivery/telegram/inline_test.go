@@ -0,0 +1,66 @@
+package telegram
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitInlineQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{}},
+		{query: " Том Харди ", want: []string{"Том Харди"}},
+		{query: "Tom Hardy+Cillian Murphy", want: []string{"Tom Hardy", "Cillian Murphy"}},
+		{query: "Том Харди + ", want: []string{"Том Харди"}},
+		{query: "a + b + c", want: []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := splitInlineQuery(tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("splitInlineQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInlinePage(t *testing.T) {
+	results := make([]any, 2*inlinePageSize+5)
+	for i := range results {
+		results[i] = i
+	}
+
+	tests := []struct {
+		name       string
+		results    []any
+		offset     string
+		wantFirst  int
+		wantLen    int
+		wantOffset string
+	}{
+		{name: "first page", results: results, offset: "", wantFirst: 0, wantLen: inlinePageSize, wantOffset: "20"},
+		{name: "middle page", results: results, offset: "20", wantFirst: 20, wantLen: inlinePageSize, wantOffset: "40"},
+		{name: "last page", results: results, offset: "40", wantFirst: 40, wantLen: 5, wantOffset: ""},
+		{name: "past the end", results: results, offset: "100", wantLen: 0, wantOffset: ""},
+		{name: "invalid offset", results: results, offset: "x", wantFirst: 0, wantLen: inlinePageSize, wantOffset: "20"},
+		{name: "no results", results: nil, offset: "", wantLen: 0, wantOffset: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, nextOffset := inlinePage(tt.results, tt.offset)
+			if page == nil {
+				t.Fatal("inlinePage() returned nil page")
+			}
+			if len(page) != tt.wantLen || nextOffset != tt.wantOffset {
+				t.Fatalf("inlinePage() = %d results, next offset %q, want %d, %q",
+					len(page), nextOffset, tt.wantLen, tt.wantOffset)
+			}
+			if len(page) > 0 && page[0] != tt.wantFirst {
+				t.Errorf("first result = %v, want %d", page[0], tt.wantFirst)
+			}
+		})
+	}
+}
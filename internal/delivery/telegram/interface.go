@@ -3,6 +3,7 @@ package telegram
 import (
 	"KinopoiskTwoActors/internal/domain"
 	"context"
+	"time"
 )
 
 type StateProvider interface {
@@ -11,13 +12,6 @@ type StateProvider interface {
 	ResetUserState(ctx context.Context, chatID int64)
 	GetCurrentStatesID(ctx context.Context) []int64
 	GetCorrelationID(ctx context.Context, chatID int64) string
-}
-
-type ActorProvider interface {
-	SearchActor(ctx context.Context, query string) ([]domain.Actor, error)
-}
-
-type FilmProvider interface {
-	GetCommonMovies(ctx context.Context, firstActorID int, secondActorID int) ([]domain.Movie,
-		error)
+	ExpireIdleStates(ctx context.Context, idleTimeout time.Duration,
+		busy func(chatID int64) bool) map[int64]domain.SessionState
 }
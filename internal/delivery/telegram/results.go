@@ -0,0 +1,221 @@
+package telegram
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	moviesPerPage  = 10
+	callbackPage   = "page"
+	callbackOption = "opt"
+	optionSort     = "sort"
+	optionRating   = "rating"
+	optionYears    = "years"
+	optionKind     = "kind"
+)
+
+type yearRange struct {
+	from  int
+	to    int
+	label string
+}
+
+var (
+	sortCycle = []domain.MovieSort{
+		domain.SortDefault, domain.SortYearDesc, domain.SortYearAsc, domain.SortRatingDesc,
+	}
+	ratingCycle = []float32{0, 6, 7, 8}
+	kindCycle   = []domain.MovieKind{domain.KindAll, domain.KindFilm, domain.KindSeries}
+	yearCycle   = []yearRange{
+		{0, 0, "все"},
+		{2010, 0, "с 2010"},
+		{2000, 2009, "2000–2009"},
+		{0, 1999, "до 2000"},
+	}
+	sortLabels = map[domain.MovieSort]string{
+		domain.SortDefault:    "по умолчанию",
+		domain.SortYearDesc:   "новые",
+		domain.SortYearAsc:    "старые",
+		domain.SortRatingDesc: "рейтинг",
+	}
+	kindLabels = map[domain.MovieKind]string{
+		domain.KindAll:    "все",
+		domain.KindFilm:   "фильмы",
+		domain.KindSeries: "сериалы",
+	}
+)
+
+func (b *Bot) sendMoviesPage(ctx context.Context, chatID int64, state *domain.SessionState) error {
+	text, markup := b.renderMoviesPage(state)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = markup
+	_, err := b.Send(msg)
+	return err
+}
+
+func (b *Bot) handlePageCallback(ctx context.Context, chatID int64, state *domain.SessionState,
+	payload string, callbackMessageID int) string {
+	page, err := strconv.Atoi(payload)
+	if err != nil {
+		b.log.ErrorContext(ctx, "Ошибка конвертации номера страницы",
+			"payload", payload,
+			errorKey, err)
+		return "Не удалось открыть страницу"
+	}
+
+	if state.Step != StepCompleted || len(state.Movies) == 0 {
+		return "Результаты поиска устарели. Введите /start"
+	}
+
+	state.Page = page
+	b.editMoviesPage(ctx, chatID, callbackMessageID, state)
+	return ""
+}
+
+func (b *Bot) handleOptionCallback(ctx context.Context, chatID int64, state *domain.SessionState,
+	payload string, callbackMessageID int) string {
+	if state.Step != StepCompleted || len(state.Movies) == 0 {
+		return "Результаты поиска устарели. Введите /start"
+	}
+
+	opts := &state.Options
+	switch payload {
+	case optionSort:
+		opts.Sort = nextInCycle(sortCycle, opts.Sort)
+	case optionRating:
+		opts.MinRating = nextInCycle(ratingCycle, opts.MinRating)
+	case optionYears:
+		years := nextInCycle(yearCycle, currentYearRange(*opts))
+		opts.YearFrom, opts.YearTo = years.from, years.to
+	case optionKind:
+		opts.Kind = nextInCycle(kindCycle, opts.Kind)
+	default:
+		b.log.ErrorContext(ctx, "Неизвестная настройка вывода",
+			"payload", payload)
+		return "Неизвестная настройка"
+	}
+
+	state.Page = 0
+	b.editMoviesPage(ctx, chatID, callbackMessageID, state)
+	return ""
+}
+
+func (b *Bot) editMoviesPage(ctx context.Context, chatID int64, messageID int,
+	state *domain.SessionState) {
+	text, markup := b.renderMoviesPage(state)
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, markup)
+	editMsg.ParseMode = tgbotapi.ModeHTML
+	editMsg.DisableWebPagePreview = true
+	if _, err := b.Send(editMsg); err != nil {
+		b.log.DebugContext(ctx, "Ошибка обновления списка фильмов",
+			"page", state.Page,
+			errorKey, err)
+	}
+}
+
+func (b *Bot) renderMoviesPage(state *domain.SessionState) (string, tgbotapi.InlineKeyboardMarkup) {
+	movies := b.ApplyOptions(state.Movies, state.Options)
+	pages := pageCount(len(movies))
+	state.Page = clampPage(state.Page, len(movies))
+	start := state.Page * moviesPerPage
+	end := min(start+moviesPerPage, len(movies))
+
+	var sb strings.Builder
+	if len(movies) == len(state.Movies) {
+		fmt.Fprintf(&sb, "Общие фильмы (%d):\n\n", len(movies))
+	} else {
+		fmt.Fprintf(&sb, "Общие фильмы (%d из %d):\n\n", len(movies), len(state.Movies))
+	}
+	if len(movies) == 0 {
+		sb.WriteString("Нет фильмов, подходящих под выбранные фильтры\n")
+	}
+	for i, movie := range movies[start:end] {
+		fmt.Fprintf(&sb, "%d. %s\n", start+i+1, formatMovie(movie))
+	}
+	if pages > 1 {
+		fmt.Fprintf(&sb, "\nСтраница %d из %d", state.Page+1, pages)
+	}
+
+	return sb.String(), moviesKeyboard(state.Options, state.Page, pages)
+}
+
+func moviesKeyboard(opts domain.MovieOptions, page int, pages int) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			optionButton("Сортировка: "+sortLabels[opts.Sort], optionSort),
+			optionButton("Тип: "+kindLabels[opts.Kind], optionKind),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			optionButton(ratingLabel(opts.MinRating), optionRating),
+			optionButton("Годы: "+currentYearRange(opts).label, optionYears),
+		),
+	}
+
+	pager := make([]tgbotapi.InlineKeyboardButton, 0, 2)
+	if page > 0 {
+		pager = append(pager, tgbotapi.NewInlineKeyboardButtonData("←",
+			callbackPage+callbackSeparator+strconv.Itoa(page-1)))
+	}
+	if page < pages-1 {
+		pager = append(pager, tgbotapi.NewInlineKeyboardButtonData("→",
+			callbackPage+callbackSeparator+strconv.Itoa(page+1)))
+	}
+	if len(pager) > 0 {
+		rows = append(rows, pager)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func optionButton(text string, option string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, callbackOption+callbackSeparator+option)
+}
+
+func ratingLabel(minRating float32) string {
+	if minRating == 0 {
+		return "Рейтинг: любой"
+	}
+	return fmt.Sprintf("Рейтинг: от %.0f", minRating)
+}
+
+func currentYearRange(opts domain.MovieOptions) yearRange {
+	for _, years := range yearCycle {
+		if years.from == opts.YearFrom && years.to == opts.YearTo {
+			return years
+		}
+	}
+	return yearRange{opts.YearFrom, opts.YearTo, fmt.Sprintf("%d–%d", opts.YearFrom, opts.YearTo)}
+}
+
+// nextInCycle returns the value following current, wrapping around. Unknown values restart the cycle.
+func nextInCycle[T comparable](cycle []T, current T) T {
+	i := slices.Index(cycle, current)
+	return cycle[(i+1)%len(cycle)]
+}
+
+func formatMovie(movie domain.Movie) string {
+	title := fmt.Sprintf("<a href=\"%s\">%s</a>", movie.MovieURL, html.EscapeString(movie.Name))
+	if movie.EngName != "" {
+		title += fmt.Sprintf(" (%s)", html.EscapeString(movie.EngName))
+	}
+	if movie.IsSeries {
+		title += ", сериал"
+	}
+	return fmt.Sprintf("%s %d, Рейтинг: %.1f", title, movie.Year, movie.Rating)
+}
+
+func pageCount(total int) int {
+	return (total + moviesPerPage - 1) / moviesPerPage
+}
+
+func clampPage(page int, total int) int {
+	return max(0, min(page, pageCount(total)-1))
+}
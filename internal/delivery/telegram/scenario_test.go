@@ -0,0 +1,454 @@
+package telegram
+
+import (
+	"KinopoiskTwoActors/configs"
+	"KinopoiskTwoActors/internal/delivery/telegram/telegramtest"
+	"KinopoiskTwoActors/internal/repository/SessionStates"
+	"KinopoiskTwoActors/internal/repository/kinopoisk"
+	"KinopoiskTwoActors/internal/repository/kinopoisk/kinopoisktest"
+	"KinopoiskTwoActors/internal/usecase"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testChatID  = 1001
+	waitTimeout = 3 * time.Second
+)
+
+// scenario drives a conversation with the bot through the fake Telegram API.
+// Expectations are matched against the calls of the bot in order; calls between
+// two expectations are skipped, so a scenario only states what matters to it.
+type scenario struct {
+	t       *testing.T
+	tg      *telegramtest.Server
+	kp      *kinopoisktest.Server
+	chatID  int64
+	seen    int
+	matched []telegramtest.Call
+	// stop cancels Run and waits for it to return.
+	stop func()
+}
+
+func newScenario(t *testing.T) *scenario {
+	t.Helper()
+	return newScenarioWithFixtures(t, kinopoisktest.DefaultFixtures())
+}
+
+// newScenarioWithFixtures starts the bot against a Kinopoisk serving fixtures.
+func newScenarioWithFixtures(t *testing.T, fixtures kinopoisktest.Fixtures) *scenario {
+	t.Helper()
+	tg := telegramtest.NewServer()
+	kp := kinopoisktest.NewServer(fixtures)
+
+	cfg := kp.Config()
+	cfg.TG = configs.TelegramConfig{
+		Token:             "test",
+		ConnectionTimeout: 5 * time.Second,
+		Mode:              configs.TelegramModePolling,
+		Workers:           2,
+		QueueSize:         10,
+		APIEndpoint:       tg.Endpoint(),
+		InlineCacheTime:   time.Minute,
+	}
+	cfg.Session = configs.SessionConfig{
+		IdleTimeout:     time.Hour,
+		CleanupInterval: time.Hour,
+	}
+
+	log := slog.New(slog.DiscardHandler)
+	repo := kinopoisk.NewRepo(cfg, kinopoisk.NewMemoryUsage(), log)
+	bot, err := NewBot(cfg, SessionStates.NewUserStates(), usecase.NewActor(repo),
+		usecase.NewFilm(repo, cfg.KP.Concurrency), log)
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bot.Run(ctx)
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(func() {
+		stop()
+		bot.StopReceivingUpdates()
+		tg.Close()
+		kp.Close()
+	})
+
+	return &scenario{t: t, tg: tg, kp: kp, chatID: testChatID, stop: stop}
+}
+
+// Sends sends a text message or a command from the user.
+func (s *scenario) Sends(text string) *scenario {
+	s.tg.SendMessage(s.chatID, text)
+	return s
+}
+
+// Presses presses the button of the most recent expected message that has it.
+func (s *scenario) Presses(text string) *scenario {
+	s.t.Helper()
+	for i := len(s.matched) - 1; i >= 0; i-- {
+		if button, ok := s.matched[i].Button(text); ok && button.CallbackData != nil {
+			s.tg.PressButton(s.chatID, s.matched[i].MessageID, *button.CallbackData)
+			return s
+		}
+	}
+	s.t.Fatalf("no expected message has the button %q", text)
+	return s
+}
+
+// ExpectsMessage waits for a message containing text and, if given, the buttons.
+func (s *scenario) ExpectsMessage(text string, buttons ...string) *scenario {
+	s.t.Helper()
+	s.expect(fmt.Sprintf("message %q with buttons %q", text, buttons),
+		matchCall("sendMessage", text, buttons))
+	return s
+}
+
+// ExpectsPhoto waits for a photo whose caption contains caption and, if given, the buttons.
+func (s *scenario) ExpectsPhoto(caption string, buttons ...string) *scenario {
+	s.t.Helper()
+	s.expect(fmt.Sprintf("photo %q with buttons %q", caption, buttons),
+		matchCall("sendPhoto", caption, buttons))
+	return s
+}
+
+// ExpectsEdit waits for the text of a message to be replaced by one containing text.
+func (s *scenario) ExpectsEdit(text string, buttons ...string) *scenario {
+	s.t.Helper()
+	s.expect(fmt.Sprintf("edited message %q with buttons %q", text, buttons),
+		matchCall("editMessageText", text, buttons))
+	return s
+}
+
+// ExpectsCall waits for a call of the Bot API method.
+func (s *scenario) ExpectsCall(method string) *scenario {
+	s.t.Helper()
+	s.expect(method, matchCall(method, "", nil))
+	return s
+}
+
+// Types sends an inline query as typed after the bot username in any chat.
+func (s *scenario) Types(query string) *scenario {
+	s.tg.SendInlineQuery(s.chatID, query, "")
+	return s
+}
+
+// ScrollsInline asks for the page of inline results starting at offset, as Telegram does on scrolling.
+func (s *scenario) ScrollsInline(query string, offset string) *scenario {
+	s.tg.SendInlineQuery(s.chatID, query, offset)
+	return s
+}
+
+// ExpectsInlineResults waits for an answer to an inline query with results titled as given, in order.
+func (s *scenario) ExpectsInlineResults(titles ...string) *scenario {
+	s.t.Helper()
+	s.expect(fmt.Sprintf("inline results %q", titles), func(call telegramtest.Call) bool {
+		if call.Method != "answerInlineQuery" || call.Params.Get("cache_time") != "60" {
+			return false
+		}
+		results := call.InlineResults()
+		return slices.EqualFunc(results, titles, func(result telegramtest.InlineResult, title string) bool {
+			return strings.Contains(result.Title, title)
+		})
+	})
+	return s
+}
+
+// ExpectsInlineHint waits for an answer to an inline query without results and with the hint button.
+func (s *scenario) ExpectsInlineHint(hint string) *scenario {
+	s.t.Helper()
+	s.expect(fmt.Sprintf("inline hint %q", hint), func(call telegramtest.Call) bool {
+		return call.Method == "answerInlineQuery" && len(call.InlineResults()) == 0 &&
+			strings.Contains(call.Params.Get("switch_pm_text"), hint)
+	})
+	return s
+}
+
+// ChoosesActor searches for the actor and picks the photo with the caption.
+func (s *scenario) ChoosesActor(query string, caption string) *scenario {
+	s.t.Helper()
+	return s.Sends(query).
+		ExpectsPhoto(caption, "Ссылка", "Выбрать").
+		Presses("Выбрать")
+}
+
+func (s *scenario) expect(description string, match func(call telegramtest.Call) bool) telegramtest.Call {
+	s.t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	next := s.seen
+	for {
+		calls, ok := s.tg.WaitCalls(next, time.Until(deadline))
+		for ; next < len(calls); next++ {
+			if match(calls[next]) {
+				s.seen = next + 1
+				s.matched = append(s.matched, calls[next])
+				return calls[next]
+			}
+		}
+		if !ok {
+			s.t.Fatalf("expected %s, got:\n%s", description, formatCalls(calls[s.seen:]))
+		}
+	}
+}
+
+func matchCall(method string, text string, buttons []string) func(call telegramtest.Call) bool {
+	return func(call telegramtest.Call) bool {
+		if call.Method != method || !strings.Contains(call.Text(), text) {
+			return false
+		}
+		for _, button := range buttons {
+			if _, ok := call.Button(button); !ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func formatCalls(calls []telegramtest.Call) string {
+	if len(calls) == 0 {
+		return "  no calls"
+	}
+	var sb strings.Builder
+	for _, call := range calls {
+		fmt.Fprintf(&sb, "  %s %q\n", call.Method, call.Text())
+	}
+	return sb.String()
+}
+
+func TestScenarioTwoActors(t *testing.T) {
+	newScenario(t).
+		Sends("/start").
+		ExpectsMessage("Введите имя первого актера").
+		Sends("Том Харди").
+		ExpectsMessage("Найдены").
+		ExpectsPhoto("Том Харди (Tom Hardy), 1977", "Ссылка", "Выбрать").
+		Presses("Выбрать").
+		ExpectsCall("deleteMessage").
+		ExpectsMessage("Введите имя второго актера").
+		ExpectsCall("editMessageReplyMarkup").
+		ExpectsCall("answerCallbackQuery").
+		Sends("Киллиан Мёрфи").
+		ExpectsPhoto("Киллиан Мёрфи (Cillian Murphy), 1976", "Выбрать").
+		Presses("Выбрать").
+		ExpectsMessage("Выбрано актеров: 2", "Готово, искать").
+		Presses("Готово, искать").
+		ExpectsCall("deleteMessage").
+		ExpectsMessage("Общие фильмы (3)", "Сортировка: по умолчанию", "Тип: все").
+		Presses("Тип: все").
+		ExpectsEdit("Общие фильмы (2 из 3)", "Тип: фильмы").
+		Presses("Тип: фильмы").
+		ExpectsEdit("Общие фильмы (1 из 3)", "Тип: сериалы").
+		ExpectsCall("answerCallbackQuery")
+}
+
+func TestScenarios(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(s *scenario)
+	}{
+		{
+			name: "help",
+			run: func(s *scenario) {
+				s.Sends("/help").ExpectsMessage("Для начала поиска нажмите /start")
+			},
+		},
+		{
+			name: "unknown command",
+			run: func(s *scenario) {
+				s.Sends("/unknown").ExpectsMessage("Неизвестная команда")
+			},
+		},
+		{
+			name: "search without start",
+			run: func(s *scenario) {
+				s.Sends("Том Харди").ExpectsMessage("Введите /start для нового поиска")
+			},
+		},
+		{
+			name: "actor not found",
+			run: func(s *scenario) {
+				s.Sends("/start").
+					Sends("Несуществующий Актер").
+					ExpectsMessage("Произошла ошибка поиска")
+			},
+		},
+		{
+			name: "kinopoisk unavailable",
+			run: func(s *scenario) {
+				s.kp.FailNext(3, http.StatusInternalServerError)
+				s.Sends("/start").
+					Sends("Том Харди").
+					ExpectsMessage("Произошла ошибка поиска")
+			},
+		},
+		{
+			name: "kinopoisk rate limited",
+			run: func(s *scenario) {
+				s.kp.RateLimitNext(3, 0)
+				s.Sends("/start").
+					Sends("Том Харди").
+					ExpectsMessage("Кинопоиск временно ограничил запросы")
+			},
+		},
+		{
+			name: "same actor twice",
+			run: func(s *scenario) {
+				s.Sends("/start").
+					ChoosesActor("Том Харди", "Том Харди (Tom Hardy)").
+					Sends("tom hardy").
+					ExpectsPhoto("Том Харди (Tom Hardy)").
+					Presses("Выбрать").
+					ExpectsMessage("Этот актер уже выбран")
+			},
+		},
+		{
+			name: "no common movies",
+			run: func(s *scenario) {
+				s.Sends("/start").
+					ChoosesActor("Том Харди", "Том Харди (Tom Hardy)").
+					ChoosesActor("Том Хэнкс", "Том Хэнкс (Tom Hanks)").
+					ExpectsMessage("Выбрано актеров: 2", "Готово, искать").
+					Presses("Готово, искать").
+					ExpectsMessage("У актеров нет общих фильмов")
+			},
+		},
+		{
+			name: "three actors",
+			run: func(s *scenario) {
+				s.Sends("/start").
+					ChoosesActor("Том Харди", "Том Харди (Tom Hardy)").
+					ChoosesActor("Киллиан Мёрфи", "Киллиан Мёрфи (Cillian Murphy)").
+					ExpectsMessage("Выбрано актеров: 2").
+					ChoosesActor("Леонардо ДиКаприо", "Леонардо ДиКаприо (Leonardo DiCaprio)").
+					ExpectsMessage("Выбрано актеров: 3", "Готово, искать").
+					Presses("Готово, искать").
+					ExpectsMessage("Общие фильмы (1)").
+					ExpectsCall("answerCallbackQuery")
+			},
+		},
+		{
+			name: "inline actor search",
+			run: func(s *scenario) {
+				s.Types("Том").ExpectsInlineResults("Том Харди", "Том Хэнкс", "Том Холланд")
+			},
+		},
+		{
+			name: "inline common movies",
+			run: func(s *scenario) {
+				s.Types("Том Харди + Cillian Murphy").
+					ExpectsInlineResults("Острые козырьки", "Дюнкерк", "Начало")
+			},
+		},
+		{
+			name: "inline next page reuses the answer",
+			run: func(s *scenario) {
+				s.Types("Том Харди + Cillian Murphy").
+					ExpectsInlineResults("Острые козырьки", "Дюнкерк", "Начало")
+				requests := len(s.kp.Requests())
+				s.ScrollsInline(" том  харди+cillian murphy", "2").
+					ExpectsInlineResults("Начало")
+				if got := len(s.kp.Requests()); got != requests {
+					s.t.Errorf("Kinopoisk requests for the next page = %d, want 0", got-requests)
+				}
+			},
+		},
+		{
+			name: "inline empty query",
+			run: func(s *scenario) {
+				s.Types("  ").ExpectsInlineHint("Введите имя актера")
+			},
+		},
+		{
+			name: "inline no common movies",
+			run: func(s *scenario) {
+				s.Types("Том Харди + Том Хэнкс").ExpectsInlineHint("У актеров нет общих фильмов")
+			},
+		},
+		{
+			name: "inline actor not found",
+			run: func(s *scenario) {
+				s.Types("Том Харди + Несуществующий Актер").ExpectsInlineHint(`Актер "Несуществующий Актер" не найден`)
+			},
+		},
+		{
+			name: "inline same actor twice",
+			run: func(s *scenario) {
+				s.Types("Tom Hardy + Том Харди").ExpectsInlineHint("Этот актер уже указан")
+			},
+		},
+		{
+			name: "inline kinopoisk unavailable",
+			run: func(s *scenario) {
+				s.kp.FailNext(3, http.StatusInternalServerError)
+				s.Types("Том Харди").ExpectsInlineHint("Ошибка поиска")
+			},
+		},
+		{
+			name: "restart drops chosen actors",
+			run: func(s *scenario) {
+				s.Sends("/start").
+					ChoosesActor("Том Харди", "Том Харди (Tom Hardy)").
+					Sends("/start").
+					ExpectsMessage("Введите имя первого актера").
+					ChoosesActor("Том Харди", "Том Харди (Tom Hardy)").
+					ExpectsMessage("Введите имя второго актера")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.run(newScenario(t))
+		})
+	}
+}
+
+func TestScenarioInlineActorsWithoutPhoto(t *testing.T) {
+	fixtures := kinopoisktest.DefaultFixtures()
+	for i, person := range fixtures.People {
+		if person.Name == "Том Харди" {
+			fixtures.People[i].PhotoURL = ""
+		}
+	}
+
+	// Search finds the namesakes but drops them all for the missing photo.
+	newScenarioWithFixtures(t, fixtures).
+		Types("Том Харди").
+		ExpectsInlineHint("Актер не найден").
+		Types("Киллиан Мёрфи + Том Харди").
+		ExpectsInlineHint(`Актер "Том Харди" не найден`)
+}
+
+func TestScenarioStopFinishesHandledUpdates(t *testing.T) {
+	s := newScenario(t)
+	s.Sends("/start").ExpectsMessage("Введите имя первого актера")
+
+	s.kp.SetLatency(300 * time.Millisecond)
+	s.Sends("Том Харди")
+	deadline := time.Now().Add(waitTimeout)
+	for s.kp.Count(kinopoisktest.RouteSearch) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("search request was not sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The search is in flight when Run is canceled, yet the user still gets the answer.
+	s.stop()
+	s.ExpectsPhoto("Том Харди (Tom Hardy)")
+}
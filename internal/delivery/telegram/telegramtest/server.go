@@ -0,0 +1,308 @@
+// Package telegramtest provides a fake Telegram Bot API for end-to-end tests of the bot.
+package telegramtest
+
+import (
+	"encoding/json"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pollWait is how long getUpdates waits for new updates before returning an empty list.
+const pollWait = 50 * time.Millisecond
+
+// Call is a Bot API request made by the bot.
+type Call struct {
+	Method string
+	Params url.Values
+	// MessageID is the message the call created or changed.
+	MessageID int
+}
+
+// Text returns the text or the caption of the message.
+func (c Call) Text() string {
+	if text := c.Params.Get("text"); text != "" {
+		return text
+	}
+	return c.Params.Get("caption")
+}
+
+// ChatID returns the chat the call was addressed to.
+func (c Call) ChatID() int64 {
+	chatID, _ := strconv.ParseInt(c.Params.Get("chat_id"), 10, 64)
+	return chatID
+}
+
+// Buttons returns the inline keyboard buttons attached to the message row by row.
+func (c Call) Buttons() []tgbotapi.InlineKeyboardButton {
+	var markup tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(c.Params.Get("reply_markup")), &markup); err != nil {
+		return nil
+	}
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, row := range markup.InlineKeyboard {
+		buttons = append(buttons, row...)
+	}
+	return buttons
+}
+
+// Button returns the button with the given text.
+func (c Call) Button(text string) (tgbotapi.InlineKeyboardButton, bool) {
+	buttons := c.Buttons()
+	i := slices.IndexFunc(buttons, func(button tgbotapi.InlineKeyboardButton) bool {
+		return button.Text == text
+	})
+	if i < 0 {
+		return tgbotapi.InlineKeyboardButton{}, false
+	}
+	return buttons[i], true
+}
+
+// InlineResult is a result of an answer to an inline query.
+type InlineResult struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ThumbURL    string `json:"thumb_url"`
+	Content     struct {
+		Text string `json:"message_text"`
+	} `json:"input_message_content"`
+}
+
+// InlineResults returns the results of an answerInlineQuery call.
+func (c Call) InlineResults() []InlineResult {
+	var results []InlineResult
+	if err := json.Unmarshal([]byte(c.Params.Get("results")), &results); err != nil {
+		return nil
+	}
+	return results
+}
+
+// Server answers the Bot API methods used by the bot and records every call.
+// Updates queued with SendMessage, PressButton and SendInlineQuery are delivered through getUpdates.
+type Server struct {
+	srv       *httptest.Server
+	mu        sync.Mutex
+	updates   []tgbotapi.Update
+	newUpdate chan struct{}
+	calls     []Call
+	newCall   chan struct{}
+	lastID    int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		newUpdate: make(chan struct{}),
+		newCall:   make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{token}/{method}", s.handle)
+	s.srv = httptest.NewServer(mux)
+	return s
+}
+
+// Endpoint returns the API endpoint format to use as TELEGRAM_API_ENDPOINT.
+func (s *Server) Endpoint() string {
+	return s.srv.URL + "/bot%s/%s"
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SendMessage queues a text message from the user of a private chat.
+// Messages starting with "/" are sent as commands.
+func (s *Server) SendMessage(chatID int64, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := &tgbotapi.Message{
+		MessageID: s.nextID(),
+		From:      user(chatID),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(command)}}
+	}
+	s.addUpdate(tgbotapi.Update{Message: msg})
+}
+
+// PressButton queues a callback query for the inline button with data under the message.
+func (s *Server) PressButton(chatID int64, messageID int, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   strconv.Itoa(s.nextID()),
+		From: user(chatID),
+		Message: &tgbotapi.Message{
+			MessageID: messageID,
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		},
+		Data: data,
+	}})
+}
+
+// SendInlineQuery queues an inline query typed by the user after the bot username.
+func (s *Server) SendInlineQuery(userID int64, query string, offset string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{
+		ID:     strconv.Itoa(s.nextID()),
+		From:   user(userID),
+		Query:  query,
+		Offset: offset,
+	}})
+}
+
+// Calls returns the calls recorded so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.calls)
+}
+
+// WaitCalls waits until more than n calls are recorded and returns all of them.
+// It returns false if no new calls arrive within timeout.
+func (s *Server) WaitCalls(n int, timeout time.Duration) ([]Call, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		calls, newCall := slices.Clone(s.calls), s.newCall
+		s.mu.Unlock()
+		if len(calls) > n {
+			return calls, true
+		}
+		select {
+		case <-newCall:
+		case <-timer.C:
+			return calls, false
+		}
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	method := r.PathValue("method")
+	params := r.PostForm
+
+	switch method {
+	case "getMe":
+		writeResult(w, tgbotapi.User{ID: 1, IsBot: true, FirstName: "Test", UserName: "test_bot"})
+	case "getUpdates":
+		offset, _ := strconv.Atoi(params.Get("offset"))
+		writeResult(w, s.pollUpdates(r, offset))
+	case "deleteWebhook", "setWebhook":
+		writeResult(w, true)
+	case "sendMessage", "sendPhoto":
+		s.mu.Lock()
+		id := s.nextID()
+		s.record(Call{Method: method, Params: params, MessageID: id})
+		s.mu.Unlock()
+		writeResult(w, message(id, params))
+	case "editMessageText", "editMessageReplyMarkup":
+		id, _ := strconv.Atoi(params.Get("message_id"))
+		s.mu.Lock()
+		s.record(Call{Method: method, Params: params, MessageID: id})
+		s.mu.Unlock()
+		writeResult(w, message(id, params))
+	case "deleteMessage", "answerCallbackQuery", "answerInlineQuery":
+		id, _ := strconv.Atoi(params.Get("message_id"))
+		s.mu.Lock()
+		s.record(Call{Method: method, Params: params, MessageID: id})
+		s.mu.Unlock()
+		writeResult(w, true)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found: method not found")
+	}
+}
+
+// pollUpdates returns the updates starting from offset, waiting shortly for new ones
+// like long polling does.
+func (s *Server) pollUpdates(r *http.Request, offset int) []tgbotapi.Update {
+	timer := time.NewTimer(pollWait)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		s.updates = slices.DeleteFunc(s.updates, func(update tgbotapi.Update) bool {
+			return update.UpdateID < offset
+		})
+		updates, newUpdate := slices.Clone(s.updates), s.newUpdate
+		s.mu.Unlock()
+		if len(updates) > 0 {
+			return updates
+		}
+		select {
+		case <-newUpdate:
+		case <-timer.C:
+			return updates
+		case <-r.Context().Done():
+			return updates
+		}
+	}
+}
+
+// addUpdate and record must be called with the mutex held.
+func (s *Server) addUpdate(update tgbotapi.Update) {
+	update.UpdateID = s.nextID()
+	s.updates = append(s.updates, update)
+	close(s.newUpdate)
+	s.newUpdate = make(chan struct{})
+}
+
+func (s *Server) record(call Call) {
+	s.calls = append(s.calls, call)
+	close(s.newCall)
+	s.newCall = make(chan struct{})
+}
+
+func (s *Server) nextID() int {
+	s.lastID++
+	return s.lastID
+}
+
+func user(chatID int64) *tgbotapi.User {
+	return &tgbotapi.User{ID: chatID, FirstName: "User" + strconv.FormatInt(chatID, 10)}
+}
+
+func message(id int, params url.Values) tgbotapi.Message {
+	chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	return tgbotapi.Message{
+		MessageID: id,
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      params.Get("text"),
+		Caption:   params.Get("caption"),
+	}
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, tgbotapi.APIResponse{Ok: true, Result: data})
+}
+
+func writeError(w http.ResponseWriter, status int, description string) {
+	writeJSON(w, status, tgbotapi.APIResponse{Ok: false, ErrorCode: status, Description: description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,72 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+)
+
+const (
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+	webhookBuffer     = 100
+)
+
+// WebhookHandler accepts updates pushed by Telegram and forwards them to Run.
+func (b *Bot) WebhookHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		secret := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(b.cfg.WebhookSecret)) != 1 {
+			b.log.WarnContext(r.Context(), "Запрос к webhook с неверным секретом", "remote_addr", r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			b.log.ErrorContext(r.Context(), "Ошибка декодирования обновления", errorKey, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Check first: a select with a free buffer slot could still accept the update after Run returned.
+		select {
+		case <-b.stopped:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		default:
+		}
+		select {
+		case b.webhookUpdates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-b.stopped:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+}
+
+func (b *Bot) setWebhook(ctx context.Context) error {
+	params := tgbotapi.Params{"url": b.cfg.WebhookURL}
+	params.AddNonEmpty("secret_token", b.cfg.WebhookSecret)
+	if _, err := b.MakeRequest("setWebhook", params); err != nil {
+		return err
+	}
+	b.log.InfoContext(ctx, "Webhook зарегистрирован", "url", b.cfg.WebhookURL)
+	return nil
+}
+
+func (b *Bot) deleteWebhook(ctx context.Context) error {
+	if _, err := b.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return err
+	}
+	b.log.InfoContext(ctx, "Webhook удален")
+	return nil
+}
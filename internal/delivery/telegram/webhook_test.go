@@ -0,0 +1,92 @@
+package telegram
+
+import (
+	"KinopoiskTwoActors/configs"
+	"KinopoiskTwoActors/internal/delivery/telegram/telegramtest"
+	"KinopoiskTwoActors/internal/repository/SessionStates"
+	"KinopoiskTwoActors/internal/repository/kinopoisk"
+	"KinopoiskTwoActors/internal/repository/kinopoisk/kinopoisktest"
+	"KinopoiskTwoActors/internal/usecase"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newWebhookBot(t *testing.T) *Bot {
+	t.Helper()
+	tg := telegramtest.NewServer()
+	kp := kinopoisktest.NewServer(kinopoisktest.DefaultFixtures())
+	t.Cleanup(func() {
+		tg.Close()
+		kp.Close()
+	})
+
+	cfg := kp.Config()
+	cfg.TG = configs.TelegramConfig{
+		Token:             "test",
+		ConnectionTimeout: 5 * time.Second,
+		Mode:              configs.TelegramModeWebhook,
+		WebhookURL:        "https://example.com/telegram/webhook",
+		WebhookSecret:     "secret",
+		Workers:           1,
+		APIEndpoint:       tg.Endpoint(),
+		InlineCacheTime:   time.Minute,
+	}
+	cfg.Session = configs.SessionConfig{IdleTimeout: time.Hour, CleanupInterval: time.Hour}
+
+	log := slog.New(slog.DiscardHandler)
+	repo := kinopoisk.NewRepo(cfg, kinopoisk.NewMemoryUsage(), log)
+	bot, err := NewBot(cfg, SessionStates.NewUserStates(), usecase.NewActor(repo),
+		usecase.NewFilm(repo, cfg.KP.Concurrency), log)
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+	return bot
+}
+
+func postUpdate(h http.Handler) int {
+	req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(`{"update_id":1}`))
+	req.Header.Set(secretTokenHeader, "secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWebhookHandlerAfterRunStopped(t *testing.T) {
+	bot := newWebhookBot(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bot.Run(ctx)
+	}()
+
+	h := bot.WebhookHandler()
+	if code := postUpdate(h); code != http.StatusOK {
+		t.Fatalf("code = %d, want %d", code, http.StatusOK)
+	}
+
+	cancel()
+	<-done
+	// The buffer still has room, yet the update must not be accepted by a bot that no longer runs.
+	if code := postUpdate(h); code != http.StatusServiceUnavailable {
+		t.Errorf("code after stop = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestPing(t *testing.T) {
+	bot := newWebhookBot(t)
+	if err := bot.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bot.Ping(ctx); err == nil {
+		t.Error("Ping() with canceled context: want error")
+	}
+}
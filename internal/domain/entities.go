@@ -18,6 +18,8 @@ type Movie struct {
 	MovieURL  string
 	Rating    float32 `json:"rating"`
 	Year      int     `json:"year"`
+	Type      string  `json:"type"`
+	IsSeries  bool    `json:"isSeries"`
 }
 
 //type SessionState struct {
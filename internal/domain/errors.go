@@ -1,9 +1,21 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrRecordNotFound = errors.New("record not found")
+	ErrRecordNotFound      = errors.New("record not found")
+	ErrRateLimited         = errors.New("rate limit exceeded")
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	ErrQuotaExceeded       = errors.New("daily quota exceeded")
+	ErrPartialResult       = errors.New("partial result")
+	// ErrStaleRecord is returned by caches together with a value past its freshness period.
+	ErrStaleRecord = errors.New("stale record")
+	// ErrCachedNotFound is a cached "not found" answer of the upstream API.
+	ErrCachedNotFound = fmt.Errorf("%w: cached", ErrRecordNotFound)
 	//ErrDBQuery        = errors.New("database query error")
 	//ErrDuplicateEntry = errors.New("duplicate entry")
 	//ErrTimeout        = errors.New("database operation timeout")
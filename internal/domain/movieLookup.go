@@ -0,0 +1,28 @@
+package domain
+
+// MovieLookup is the result of a batch cache lookup.
+type MovieLookup struct {
+	// Movies holds fresh and stale hits by movie ID.
+	Movies map[int]Movie
+	// Stale lists the hits past their freshness period.
+	Stale []int
+	// NotFound lists the IDs cached as missing upstream.
+	NotFound []int
+}
+
+func NewMovieLookup(size int) MovieLookup {
+	return MovieLookup{Movies: make(map[int]Movie, size)}
+}
+
+// Has reports whether the cache answered for the movie, including "not found" answers.
+func (l MovieLookup) Has(movieID int) bool {
+	if _, ok := l.Movies[movieID]; ok {
+		return true
+	}
+	for _, id := range l.NotFound {
+		if id == movieID {
+			return true
+		}
+	}
+	return false
+}
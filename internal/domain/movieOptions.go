@@ -0,0 +1,45 @@
+package domain
+
+import "fmt"
+
+type MovieSort string
+
+const (
+	SortDefault    MovieSort = ""
+	SortYearAsc    MovieSort = "year_asc"
+	SortYearDesc   MovieSort = "year_desc"
+	SortRatingDesc MovieSort = "rating_desc"
+)
+
+type MovieKind string
+
+const (
+	KindAll    MovieKind = ""
+	KindFilm   MovieKind = "film"
+	KindSeries MovieKind = "series"
+)
+
+// MovieOptions describes how common movies are filtered and ordered.
+// Zero values mean "no restriction" and keep the original order.
+type MovieOptions struct {
+	Sort      MovieSort
+	MinRating float32
+	YearFrom  int
+	YearTo    int
+	Kind      MovieKind
+}
+
+// Validate reports unknown sort orders and kinds, which come from user input.
+func (o MovieOptions) Validate() error {
+	switch o.Sort {
+	case SortDefault, SortYearAsc, SortYearDesc, SortRatingDesc:
+	default:
+		return fmt.Errorf("неизвестная сортировка %q", o.Sort)
+	}
+	switch o.Kind {
+	case KindAll, KindFilm, KindSeries:
+	default:
+		return fmt.Errorf("неизвестный тип %q", o.Kind)
+	}
+	return nil
+}
@@ -3,10 +3,12 @@ package domain
 type SessionState struct {
 	CorrelationID     string
 	Step              string
-	FirstActorID      int
-	SecondActorID     int
+	ActorIDs          []int
 	SentMediaMessages []int
 	TempActors        []PhotoData
+	Movies            []Movie
+	Options           MovieOptions
+	Page              int
 }
 
 type PhotoData struct {
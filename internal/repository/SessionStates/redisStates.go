@@ -0,0 +1,166 @@
+package SessionStates
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/pkg/prometheus"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+const (
+	sessionPrefix = "session:"
+	activityKey   = "session:activity"
+)
+
+// expireScript removes the session only if it is still idle, so a session touched
+// by another replica after the idle list was read is kept.
+// KEYS: activity set, session; ARGV: chat ID, deadline.
+var expireScript = redis.NewScript(`
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not score or tonumber(score) > tonumber(ARGV[2]) then
+	return false
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+return redis.call("GETDEL", KEYS[2])
+`)
+
+// RedisStates keeps sessions in Redis so they survive restarts and are shared between replicas.
+type RedisStates struct {
+	client *redis.Client
+	ttl    time.Duration
+	log    *slog.Logger
+}
+
+func NewRedisStates(client *redis.Client, ttl time.Duration, log *slog.Logger) *RedisStates {
+	return &RedisStates{
+		client: client,
+		ttl:    ttl,
+		log:    log,
+	}
+}
+
+// GetCurrentStatesID returns no sessions: they are kept in Redis and survive the shutdown,
+// so there is nobody to notify about a lost search.
+func (s *RedisStates) GetCurrentStatesID(ctx context.Context) []int64 {
+	return nil
+}
+
+func (s *RedisStates) GetStateByID(ctx context.Context, chatID int64) *domain.SessionState {
+	data, err := s.client.Get(ctx, sessionKey(chatID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return newSessionState()
+	} else if err != nil {
+		s.log.ErrorContext(ctx, "Ошибка получения состояния из Redis", "chat_id", chatID, "error", err)
+		return newSessionState()
+	}
+
+	state := newSessionState()
+	if err = json.Unmarshal(data, state); err != nil {
+		s.log.ErrorContext(ctx, "Ошибка конвертации состояния из Redis", "chat_id", chatID, "error", err)
+		return newSessionState()
+	}
+	return state
+}
+
+func (s *RedisStates) ResetUserState(ctx context.Context, chatID int64) {
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, sessionKey(chatID))
+	pipe.ZRem(ctx, activityKey, chatID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.log.ErrorContext(ctx, "Ошибка удаления состояния из Redis", "chat_id", chatID, "error", err)
+	}
+}
+
+// ExpireIdleStates removes sessions without activity for longer than idleTimeout,
+// except those for which busy reports an update being handled, and returns the removed states.
+// A session is returned by exactly one replica.
+func (s *RedisStates) ExpireIdleStates(ctx context.Context, idleTimeout time.Duration,
+	busy func(chatID int64) bool) map[int64]domain.SessionState {
+	expired := make(map[int64]domain.SessionState)
+	deadline := time.Now().Add(-idleTimeout).Unix()
+	members, err := s.client.ZRangeByScore(ctx, activityKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(deadline, 10),
+	}).Result()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Ошибка получения неактивных сессий из Redis", "error", err)
+		return expired
+	}
+
+	for _, member := range members {
+		chatID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil || busy(chatID) {
+			continue
+		}
+		if state, ok := s.expire(ctx, chatID, deadline); ok {
+			expired[chatID] = state
+		}
+	}
+
+	if count, err := s.client.ZCard(ctx, activityKey).Result(); err == nil {
+		prometheus.ActiveSessions.Set(float64(count))
+	}
+	return expired
+}
+
+// expire atomically removes the session if its last activity is not after deadline.
+func (s *RedisStates) expire(ctx context.Context, chatID int64, deadline int64) (domain.SessionState, bool) {
+	data, err := expireScript.Run(ctx, s.client, []string{activityKey, sessionKey(chatID)},
+		chatID, deadline).Text()
+	if errors.Is(err, redis.Nil) {
+		return domain.SessionState{}, false
+	} else if err != nil {
+		s.log.ErrorContext(ctx, "Ошибка удаления неактивной сессии из Redis", "chat_id", chatID, "error", err)
+		return domain.SessionState{}, false
+	}
+
+	var state domain.SessionState
+	if err = json.Unmarshal([]byte(data), &state); err != nil {
+		return domain.SessionState{}, false
+	}
+	return state, true
+}
+
+func (s *RedisStates) GetCorrelationID(ctx context.Context, chatID int64) string {
+	state := s.GetStateByID(ctx, chatID)
+	// Saved sessions always have a step; saving a stepless state would create a session for any chat.
+	if state.Step == "" {
+		return generateCorrelationID()
+	}
+	if state.CorrelationID == "" {
+		state.CorrelationID = generateCorrelationID()
+		if err := s.SetState(ctx, chatID, state); err != nil {
+			s.log.ErrorContext(ctx, "Ошибка сохранения состояния в Redis", "chat_id", chatID, "error", err)
+		}
+	}
+	return state.CorrelationID
+}
+
+// SetState stores the session and refreshes its TTL.
+func (s *RedisStates) SetState(ctx context.Context, chatID int64, state *domain.SessionState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, sessionKey(chatID), data, s.ttl)
+	pipe.ZAdd(ctx, activityKey, redis.Z{Score: float64(time.Now().Unix()), Member: chatID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func sessionKey(chatID int64) string {
+	return sessionPrefix + strconv.FormatInt(chatID, 10)
+}
+
+func newSessionState() *domain.SessionState {
+	return &domain.SessionState{
+		SentMediaMessages: []int{},
+		TempActors:        []domain.PhotoData{},
+	}
+}
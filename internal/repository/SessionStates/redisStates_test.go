@@ -0,0 +1,92 @@
+package SessionStates
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestRedisStates(t *testing.T) (*RedisStates, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisStates(client, time.Hour, slog.New(slog.DiscardHandler)), mr
+}
+
+func TestRedisStatesSetAndGet(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestRedisStates(t)
+
+	if state := s.GetStateByID(ctx, 1); state.Step != "" {
+		t.Fatalf("Step = %q, want empty", state.Step)
+	}
+	s.GetCorrelationID(ctx, 1)
+	if mr.Exists(sessionKey(1)) {
+		t.Fatal("session was created without SetState")
+	}
+
+	want := &domain.SessionState{Step: "actor", ActorIDs: []int{10}, CorrelationID: "id"}
+	if err := s.SetState(ctx, 1, want); err != nil {
+		t.Fatalf("SetState() error = %v", err)
+	}
+	got := s.GetStateByID(ctx, 1)
+	if got.Step != want.Step || len(got.ActorIDs) != 1 || got.ActorIDs[0] != 10 {
+		t.Errorf("GetStateByID() = %+v, want %+v", got, want)
+	}
+	if id := s.GetCorrelationID(ctx, 1); id != "id" {
+		t.Errorf("GetCorrelationID() = %q, want %q", id, "id")
+	}
+	if ttl := mr.TTL(sessionKey(1)); ttl != time.Hour {
+		t.Errorf("TTL = %s, want %s", ttl, time.Hour)
+	}
+
+	s.ResetUserState(ctx, 1)
+	if mr.Exists(sessionKey(1)) {
+		t.Error("session was not removed by ResetUserState")
+	}
+}
+
+func TestRedisStatesExpireIdleStates(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestRedisStates(t)
+	for _, chatID := range []int64{1, 2} {
+		if err := s.SetState(ctx, chatID, &domain.SessionState{Step: "actor"}); err != nil {
+			t.Fatalf("SetState() error = %v", err)
+		}
+	}
+
+	busy := func(chatID int64) bool { return chatID == 2 }
+	expired := s.ExpireIdleStates(ctx, -time.Minute, busy)
+	if state, ok := expired[1]; !ok || state.Step != "actor" || len(expired) != 1 {
+		t.Fatalf("expired = %v, want only chat 1", expired)
+	}
+	if mr.Exists(sessionKey(1)) || !mr.Exists(sessionKey(2)) {
+		t.Errorf("sessions after expiry: chat 1 %v, chat 2 %v, want only chat 2",
+			mr.Exists(sessionKey(1)), mr.Exists(sessionKey(2)))
+	}
+}
+
+func TestRedisStatesExpireKeepsTouchedSession(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestRedisStates(t)
+	if err := s.SetState(ctx, 1, &domain.SessionState{Step: "actor"}); err != nil {
+		t.Fatalf("SetState() error = %v", err)
+	}
+
+	// Another replica touched the session after the idle list was read with an older deadline.
+	deadline := time.Now().Add(-time.Minute).Unix()
+	if _, ok := s.expire(ctx, 1, deadline); ok {
+		t.Fatal("expire() removed a session active after the deadline")
+	}
+	if !mr.Exists(sessionKey(1)) {
+		t.Fatal("session was removed")
+	}
+	if score, err := mr.ZScore(activityKey, "1"); err != nil || score <= float64(deadline) {
+		t.Errorf("activity = %v, %v, want kept", score, err)
+	}
+}
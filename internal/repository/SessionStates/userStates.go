@@ -2,21 +2,26 @@ package SessionStates
 
 import (
 	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/pkg/prometheus"
 	"context"
 	"github.com/google/uuid"
+	"slices"
 	"sync"
+	"time"
 )
 
 type SessionStates struct {
-	states map[int64]*domain.SessionState
-	mu     sync.RWMutex
+	states   map[int64]*domain.SessionState
+	activity map[int64]time.Time
+	mu       sync.RWMutex
 }
 
 func NewUserStates() *SessionStates {
 	states := make(map[int64]*domain.SessionState)
 	return &SessionStates{
-		states: states,
-		mu:     sync.RWMutex{},
+		states:   states,
+		activity: make(map[int64]time.Time),
+		mu:       sync.RWMutex{},
 	}
 }
 
@@ -33,27 +38,61 @@ func (s *SessionStates) GetCurrentStatesID(ctx context.Context) []int64 {
 	return states
 }
 
+// GetStateByID returns a copy of the session, so handlers change it without holding the lock
+// and publish the changes with SetState. Chats without a session get an empty state that is not stored.
 func (s *SessionStates) GetStateByID(ctx context.Context, chatID int64) *domain.SessionState {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, ok := s.states[chatID]; !ok {
-		s.states[chatID] = &domain.SessionState{
-			SentMediaMessages: []int{},
-			TempActors:        []domain.PhotoData{},
-		}
+	state, ok := s.states[chatID]
+	if !ok {
+		return newSessionState()
 	}
-	return s.states[chatID]
+	s.activity[chatID] = time.Now()
+	return cloneState(state)
 }
 
 func (s *SessionStates) ResetUserState(ctx context.Context, chatID int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.states, chatID)
+	delete(s.activity, chatID)
+	prometheus.ActiveSessions.Set(float64(len(s.states)))
 }
 
+// ExpireIdleStates removes sessions without activity for longer than idleTimeout,
+// except those for which busy reports an update being handled, and returns the removed states.
+func (s *SessionStates) ExpireIdleStates(ctx context.Context, idleTimeout time.Duration,
+	busy func(chatID int64) bool) map[int64]domain.SessionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := make(map[int64]domain.SessionState)
+	deadline := time.Now().Add(-idleTimeout)
+	for chatID, lastActivity := range s.activity {
+		if lastActivity.After(deadline) || busy(chatID) {
+			continue
+		}
+		if state := s.states[chatID]; state != nil {
+			expired[chatID] = *state
+		}
+		delete(s.states, chatID)
+		delete(s.activity, chatID)
+	}
+	prometheus.ActiveSessions.Set(float64(len(s.states)))
+	return expired
+}
+
+// GetCorrelationID returns the correlation ID of the session. Chats without a session
+// get a new ID every time, since there is nothing to correlate.
 func (s *SessionStates) GetCorrelationID(ctx context.Context, chatID int64) string {
-	state := s.GetStateByID(ctx, chatID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[chatID]
+	if !ok {
+		return generateCorrelationID()
+	}
 	if state.CorrelationID == "" {
 		state.CorrelationID = generateCorrelationID()
 	}
@@ -67,6 +106,17 @@ func generateCorrelationID() string {
 func (s *SessionStates) SetState(ctx context.Context, chatID int64, state *domain.SessionState) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.states[chatID] = state
+	s.states[chatID] = cloneState(state)
+	s.activity[chatID] = time.Now()
+	prometheus.ActiveSessions.Set(float64(len(s.states)))
 	return nil
 }
+
+func cloneState(state *domain.SessionState) *domain.SessionState {
+	clone := *state
+	clone.ActorIDs = slices.Clone(state.ActorIDs)
+	clone.SentMediaMessages = slices.Clone(state.SentMediaMessages)
+	clone.TempActors = slices.Clone(state.TempActors)
+	clone.Movies = slices.Clone(state.Movies)
+	return &clone
+}
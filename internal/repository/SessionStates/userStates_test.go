@@ -0,0 +1,57 @@
+package SessionStates
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetStateByIDDoesNotCreateSession(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserStates()
+
+	if state := s.GetStateByID(ctx, 1); state.Step != "" {
+		t.Fatalf("Step = %q, want empty", state.Step)
+	}
+	s.GetCorrelationID(ctx, 1)
+	if ids := s.GetCurrentStatesID(ctx); len(ids) != 0 {
+		t.Errorf("GetCurrentStatesID() = %v, want no sessions", ids)
+	}
+}
+
+func TestGetStateByIDReturnsCopy(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserStates()
+	if err := s.SetState(ctx, 1, &domain.SessionState{Step: "actor", ActorIDs: []int{10}}); err != nil {
+		t.Fatalf("SetState() error = %v", err)
+	}
+
+	state := s.GetStateByID(ctx, 1)
+	state.Step = "changed"
+	state.ActorIDs[0] = 20
+
+	stored := s.GetStateByID(ctx, 1)
+	if stored.Step != "actor" || stored.ActorIDs[0] != 10 {
+		t.Errorf("stored state = %+v, changed without SetState", stored)
+	}
+}
+
+func TestExpireIdleStatesSkipsBusyChats(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserStates()
+	for _, chatID := range []int64{1, 2} {
+		if err := s.SetState(ctx, chatID, &domain.SessionState{Step: "actor"}); err != nil {
+			t.Fatalf("SetState() error = %v", err)
+		}
+	}
+
+	busy := func(chatID int64) bool { return chatID == 2 }
+	expired := s.ExpireIdleStates(ctx, -time.Second, busy)
+	if _, ok := expired[1]; !ok || len(expired) != 1 {
+		t.Fatalf("expired = %v, want only chat 1", expired)
+	}
+	if state := s.GetStateByID(ctx, 2); state.Step != "actor" {
+		t.Errorf("busy chat session was removed")
+	}
+}
@@ -3,27 +3,52 @@ package cachedRepo
 import (
 	"KinopoiskTwoActors/internal/domain"
 	"KinopoiskTwoActors/pkg/prometheus"
+	"KinopoiskTwoActors/pkg/tracing"
 	"context"
 	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	entityMovie       = "movie"
+	entityFilmography = "filmography"
+	entitySearch      = "search"
 )
 
 type ActorFilmRepository interface {
 	SearchActors(ctx context.Context, query string) ([]domain.Actor, error)
 	GetMoviesIDByActorID(ctx context.Context, actorID int) ([]int, error)
 	GetMovieByID(ctx context.Context, movieID int) (domain.Movie, error)
+	GetMoviesByIDs(ctx context.Context, movieIDs []int) ([]domain.Movie, error)
 }
 
 type CacheRepository interface {
 	GetMovieByID(ctx context.Context, movieID int) (domain.Movie, error)
 	SetMovie(ctx context.Context, movie domain.Movie) error
+	GetMoviesByIDs(ctx context.Context, movieIDs []int) (domain.MovieLookup, error)
+	SetMovies(ctx context.Context, movies []domain.Movie) error
+	SetMoviesNotFound(ctx context.Context, movieIDs []int) error
+	GetMoviesIDByActorID(ctx context.Context, actorID int) ([]int, error)
+	SetMoviesIDByActorID(ctx context.Context, actorID int, movies []int) error
+	SearchActors(ctx context.Context, query string) ([]domain.Actor, error)
+	SetSearchActors(ctx context.Context, query string, actors []domain.Actor) error
+	SetSearchNotFound(ctx context.Context, query string) error
 }
 
 type CachedRepo struct {
-	repo  ActorFilmRepository
-	cache CacheRepository
-	log   *slog.Logger
+	repo    ActorFilmRepository
+	cache   CacheRepository
+	flights singleflight.Group
+	// pending tracks background refreshes and cache writes.
+	pending sync.WaitGroup
+	log     *slog.Logger
 }
 
 func NewCachedRepo(repo ActorFilmRepository, cache CacheRepository, log *slog.Logger) *CachedRepo {
@@ -35,39 +60,321 @@ func NewCachedRepo(repo ActorFilmRepository, cache CacheRepository, log *slog.Lo
 	}
 }
 
+// Wait blocks until background refreshes and cache writes finish. Short-lived processes
+// call it before exiting so that the loaded data stays in the cache.
+func (r *CachedRepo) Wait() {
+	r.pending.Wait()
+}
+
 func (r *CachedRepo) SearchActors(ctx context.Context, query string) ([]domain.Actor, error) {
-	return r.repo.SearchActors(ctx, query)
+	const op = "cachedRepo.SearchActors"
+	ctx, span := tracing.Start(ctx, op, attribute.String("query", query))
+	key := normalizeQuery(query)
+	actors, err := loadThrough(ctx, r, entitySearch, key,
+		func(ctx context.Context) ([]domain.Actor, error) {
+			return r.cache.SearchActors(ctx, key)
+		},
+		func(ctx context.Context) ([]domain.Actor, error) {
+			return r.repo.SearchActors(ctx, query)
+		},
+		func(ctx context.Context, actors []domain.Actor) error {
+			if len(actors) == 0 {
+				return r.cache.SetSearchNotFound(ctx, key)
+			}
+			return r.cache.SetSearchActors(ctx, key, actors)
+		}, nil)
+	if errors.Is(err, domain.ErrCachedNotFound) {
+		err = nil
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return actors, nil
 }
+
 func (r *CachedRepo) GetMoviesIDByActorID(ctx context.Context, actorID int) ([]int, error) {
-	return r.repo.GetMoviesIDByActorID(ctx, actorID)
+	const op = "cachedRepo.GetMoviesIDByActorID"
+	ctx, span := tracing.Start(ctx, op, attribute.Int("actor_id", actorID))
+	movies, err := loadThrough(ctx, r, entityFilmography, actorID,
+		func(ctx context.Context) ([]int, error) {
+			return r.cache.GetMoviesIDByActorID(ctx, actorID)
+		},
+		func(ctx context.Context) ([]int, error) {
+			return r.repo.GetMoviesIDByActorID(ctx, actorID)
+		},
+		func(ctx context.Context, movies []int) error {
+			return r.cache.SetMoviesIDByActorID(ctx, actorID, movies)
+		}, nil)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return movies, nil
 }
+
 func (r *CachedRepo) GetMovieByID(ctx context.Context, movieID int) (domain.Movie, error) {
 	const op = "cachedRepo.GetMovieByID"
-	movie, err := r.cache.GetMovieByID(ctx, movieID)
-	if err == nil {
-		prometheus.CacheOperations.WithLabelValues("hit").Inc()
-		return movie, nil
+	ctx, span := tracing.Start(ctx, op, attribute.Int("movie_id", movieID))
+	movie, err := loadThrough(ctx, r, entityMovie, movieID,
+		func(ctx context.Context) (domain.Movie, error) {
+			return r.cache.GetMovieByID(ctx, movieID)
+		},
+		func(ctx context.Context) (domain.Movie, error) {
+			return r.repo.GetMovieByID(ctx, movieID)
+		},
+		func(ctx context.Context, movie domain.Movie) error {
+			return r.cache.SetMovie(ctx, movie)
+		},
+		func(ctx context.Context) error {
+			return r.cache.SetMoviesNotFound(ctx, []int{movieID})
+		})
+	tracing.End(span, err)
+	if err != nil {
+		return domain.Movie{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return movie, nil
+}
+
+// GetMoviesByIDs serves cached movies and loads the rest with a single batch request.
+// Stale movies are returned as is and refreshed in the background.
+func (r *CachedRepo) GetMoviesByIDs(ctx context.Context, movieIDs []int) ([]domain.Movie, error) {
+	const op = "cachedRepo.GetMoviesByIDs"
+	ctx, span := tracing.Start(ctx, op, attribute.Int("movies", len(movieIDs)))
+	movies, err := r.getMoviesByIDs(ctx, movieIDs)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	if !errors.Is(err, domain.ErrRecordNotFound) {
-		prometheus.CacheOperations.WithLabelValues("error").Inc()
+	return movies, nil
+}
+
+func (r *CachedRepo) getMoviesByIDs(ctx context.Context, movieIDs []int) ([]domain.Movie, error) {
+	lookup, err := r.cache.GetMoviesByIDs(ctx, movieIDs)
+	if err != nil {
+		prometheus.CacheOperations.WithLabelValues(entityMovie, "error").Inc()
 		r.log.WarnContext(ctx, "cache lookup failed",
-			"movieID", movieID,
+			"entity", entityMovie,
+			"key", movieIDs,
 			"error", err,
 		)
+		// Tiers in front of the failed one may still have returned their hits.
+		if lookup.Movies == nil {
+			lookup = domain.NewMovieLookup(len(movieIDs))
+		}
+	}
+
+	missing := make([]int, 0, len(movieIDs))
+	for _, id := range movieIDs {
+		if !lookup.Has(id) {
+			missing = append(missing, id)
+		}
+	}
+	stale := len(lookup.Stale)
+	prometheus.CacheOperations.WithLabelValues(entityMovie, "hit").Add(float64(len(lookup.Movies) - stale))
+	prometheus.CacheOperations.WithLabelValues(entityMovie, "stale").Add(float64(stale))
+	prometheus.CacheOperations.WithLabelValues(entityMovie, "negative").Add(float64(len(lookup.NotFound)))
+	prometheus.CacheOperations.WithLabelValues(entityMovie, "miss").Add(float64(len(missing)))
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("cache.hits", len(lookup.Movies)-stale),
+		attribute.Int("cache.stale", stale),
+		attribute.Int("cache.negative", len(lookup.NotFound)),
+		attribute.Int("cache.misses", len(missing)))
+
+	if stale > 0 {
+		r.refreshMovies(ctx, lookup.Stale)
+	}
+	if len(missing) > 0 {
+		fetched, err := r.loadMovies(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, movie := range fetched {
+			lookup.Movies[movie.ID] = movie
+		}
+	}
+
+	movies := make([]domain.Movie, 0, len(lookup.Movies))
+	for _, id := range movieIDs {
+		if movie, ok := lookup.Movies[id]; ok {
+			movies = append(movies, movie)
+		}
+	}
+	return movies, nil
+}
+
+// loadMovies fetches movies missing from the cache. Concurrent misses for the same
+// set of ids share one upstream call, which runs without cancellation like in loadThrough.
+func (r *CachedRepo) loadMovies(ctx context.Context, movieIDs []int) ([]domain.Movie, error) {
+	var leader bool
+	flight := r.flights.DoChan(moviesFlightKey(movieIDs), func() (any, error) {
+		leader = true
+		return r.fetchMovies(context.WithoutCancel(ctx), movieIDs)
+	})
+
+	select {
+	case res := <-flight:
+		if !leader {
+			prometheus.CacheCoalesced.WithLabelValues(entityMovie).Inc()
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]domain.Movie), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	prometheus.CacheOperations.WithLabelValues("miss").Inc()
-	movie, err = r.repo.GetMovieByID(ctx, movieID)
+}
+
+// fetchMovies loads movies from the repository and caches them together with
+// "not found" answers for the ids the repository did not return.
+func (r *CachedRepo) fetchMovies(ctx context.Context, movieIDs []int) ([]domain.Movie, error) {
+	movies, err := r.repo.GetMoviesByIDs(ctx, movieIDs)
 	if err != nil {
-		return domain.Movie{}, fmt.Errorf("%s: %w", op, err)
+		return nil, err
+	}
+
+	notFound := slices.DeleteFunc(slices.Clone(movieIDs), func(id int) bool {
+		return slices.ContainsFunc(movies, func(movie domain.Movie) bool {
+			return movie.ID == id
+		})
+	})
+	r.store(ctx, entityMovie, movieIDs, func(ctx context.Context) error {
+		if err := r.cache.SetMovies(ctx, movies); err != nil {
+			return err
+		}
+		return r.cache.SetMoviesNotFound(ctx, notFound)
+	})
+	return movies, nil
+}
+
+// refreshMovies reloads stale movies in the background.
+func (r *CachedRepo) refreshMovies(ctx context.Context, movieIDs []int) {
+	ctx = context.WithoutCancel(ctx)
+	r.pending.Add(1)
+	flight := r.flights.DoChan(moviesFlightKey(movieIDs), func() (any, error) {
+		return r.fetchMovies(ctx, movieIDs)
+	})
+	go func() {
+		defer r.pending.Done()
+		if res := <-flight; res.Err != nil {
+			r.log.WarnContext(ctx, "background refresh failed",
+				"entity", entityMovie,
+				"key", movieIDs,
+				"error", res.Err,
+			)
+		}
+	}()
+}
+
+// moviesFlightKey identifies a batch of movies regardless of the order of the ids.
+func moviesFlightKey(movieIDs []int) string {
+	return fmt.Sprintf("%s:%v", entityMovie, slices.Sorted(slices.Values(movieIDs)))
+}
+
+// loadThrough returns the cached value or fetches it from the repository
+// and stores it in the cache in the background. Concurrent misses for the same
+// key share one upstream call. Stale values are returned immediately and refreshed
+// in the background; cached "not found" answers are returned as domain.ErrCachedNotFound.
+// setMissing caches a "not found" answer of the repository and may be nil.
+func loadThrough[T any](ctx context.Context, r *CachedRepo, entity string, key any,
+	get func(ctx context.Context) (T, error),
+	fetch func(ctx context.Context) (T, error),
+	set func(ctx context.Context, value T) error,
+	setMissing func(ctx context.Context) error) (T, error) {
+	flightKey := fmt.Sprintf("%s:%v", entity, key)
+	// The shared call must outlive the caller that started it, so it runs
+	// without cancellation and every caller waits on its own context.
+	load := func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		value, err := fetch(ctx)
+		switch {
+		case err == nil:
+			r.store(ctx, entity, key, func(ctx context.Context) error {
+				return set(ctx, value)
+			})
+		case errors.Is(err, domain.ErrRecordNotFound) && setMissing != nil:
+			r.store(ctx, entity, key, setMissing)
+		}
+		return value, err
+	}
+
+	value, err := get(ctx)
+	span := trace.SpanFromContext(ctx)
+	switch {
+	case err == nil:
+		prometheus.CacheOperations.WithLabelValues(entity, "hit").Inc()
+		span.SetAttributes(attribute.String("cache.status", "hit"))
+		return value, nil
+	case errors.Is(err, domain.ErrStaleRecord):
+		prometheus.CacheOperations.WithLabelValues(entity, "stale").Inc()
+		span.SetAttributes(attribute.String("cache.status", "stale"))
+		r.pending.Add(1)
+		flight := r.flights.DoChan(flightKey, load)
+		go func() {
+			defer r.pending.Done()
+			if res := <-flight; res.Err != nil {
+				r.log.WarnContext(ctx, "background refresh failed",
+					"entity", entity,
+					"key", key,
+					"error", res.Err,
+				)
+			}
+		}()
+		return value, nil
+	case errors.Is(err, domain.ErrCachedNotFound):
+		prometheus.CacheOperations.WithLabelValues(entity, "negative").Inc()
+		span.SetAttributes(attribute.String("cache.status", "negative"))
+		return value, err
+	case !errors.Is(err, domain.ErrRecordNotFound):
+		prometheus.CacheOperations.WithLabelValues(entity, "error").Inc()
+		r.log.WarnContext(ctx, "cache lookup failed",
+			"entity", entity,
+			"key", key,
+			"error", err,
+		)
 	}
+	prometheus.CacheOperations.WithLabelValues(entity, "miss").Inc()
+	span.SetAttributes(attribute.String("cache.status", "miss"))
 
+	var leader bool
+	flight := r.flights.DoChan(flightKey, func() (any, error) {
+		leader = true
+		return load()
+	})
+
+	select {
+	case res := <-flight:
+		if !leader {
+			prometheus.CacheCoalesced.WithLabelValues(entity).Inc()
+		}
+		if res.Err != nil {
+			var zero T
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// store writes to the cache in the background so callers do not wait for it.
+func (r *CachedRepo) store(ctx context.Context, entity string, key any, set func(ctx context.Context) error) {
+	r.pending.Add(1)
 	go func() {
-		if err = r.cache.SetMovie(ctx, movie); err != nil {
-			r.log.ErrorContext(ctx, "failed to cache movie",
-				"movieID", movieID,
+		defer r.pending.Done()
+		ctx := context.WithoutCancel(ctx)
+		if err := set(ctx); err != nil {
+			r.log.ErrorContext(ctx, "failed to cache value",
+				"entity", entity,
+				"key", key,
 				"error", err,
 			)
 		}
 	}()
-	return movie, nil
+}
+
+func normalizeQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
 }
@@ -0,0 +1,241 @@
+package cachedRepo
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/internal/repository/kinopoisk/kinopoisktest"
+	"KinopoiskTwoActors/internal/repository/memoryCache"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestRepo(t *testing.T) (*CachedRepo, *memoryCache.MemoryCache, *kinopoisktest.Server) {
+	t.Helper()
+	repo, srv := kinopoisktest.NewRepo(t)
+	cache := memoryCache.NewCache(srv.Config())
+	return NewCachedRepo(repo, cache, slog.New(slog.DiscardHandler)), cache, srv
+}
+
+// waitCached waits until the background write of the value lands in the cache.
+func waitCached(t *testing.T, lookup func(ctx context.Context) error) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := lookup(context.Background())
+		if err == nil || errors.Is(err, domain.ErrCachedNotFound) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("value was not cached: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCachedRepoServesRepeatedCallsFromCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   string
+		call    func(ctx context.Context, r *CachedRepo) (any, error)
+		cached  func(ctx context.Context, c *memoryCache.MemoryCache) error
+		wantErr error
+	}{
+		{
+			name:  "search",
+			route: kinopoisktest.RouteSearch,
+			call: func(ctx context.Context, r *CachedRepo) (any, error) {
+				return r.SearchActors(ctx, "Том Харди")
+			},
+			cached: func(ctx context.Context, c *memoryCache.MemoryCache) error {
+				_, err := c.SearchActors(ctx, "том харди")
+				return err
+			},
+		},
+		{
+			name:  "search without results",
+			route: kinopoisktest.RouteSearch,
+			call: func(ctx context.Context, r *CachedRepo) (any, error) {
+				return r.SearchActors(ctx, "Несуществующий Актер")
+			},
+			cached: func(ctx context.Context, c *memoryCache.MemoryCache) error {
+				_, err := c.SearchActors(ctx, "несуществующий актер")
+				return err
+			},
+		},
+		{
+			name:  "filmography",
+			route: kinopoisktest.RoutePerson,
+			call: func(ctx context.Context, r *CachedRepo) (any, error) {
+				return r.GetMoviesIDByActorID(ctx, 8027)
+			},
+			cached: func(ctx context.Context, c *memoryCache.MemoryCache) error {
+				_, err := c.GetMoviesIDByActorID(ctx, 8027)
+				return err
+			},
+		},
+		{
+			name:  "movie",
+			route: kinopoisktest.RouteMovie,
+			call: func(ctx context.Context, r *CachedRepo) (any, error) {
+				return r.GetMovieByID(ctx, 447301)
+			},
+			cached: func(ctx context.Context, c *memoryCache.MemoryCache) error {
+				_, err := c.GetMovieByID(ctx, 447301)
+				return err
+			},
+		},
+		{
+			name:  "missing movie",
+			route: kinopoisktest.RouteMovie,
+			call: func(ctx context.Context, r *CachedRepo) (any, error) {
+				return r.GetMovieByID(ctx, 999999)
+			},
+			cached: func(ctx context.Context, c *memoryCache.MemoryCache) error {
+				_, err := c.GetMovieByID(ctx, 999999)
+				return err
+			},
+			wantErr: domain.ErrRecordNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, cache, srv := newTestRepo(t)
+			ctx := context.Background()
+
+			first, err := tt.call(ctx, repo)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("first call error = %v, want %v", err, tt.wantErr)
+			}
+			waitCached(t, func(ctx context.Context) error {
+				return tt.cached(ctx, cache)
+			})
+			second, err := tt.call(ctx, repo)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("second call error = %v, want %v", err, tt.wantErr)
+			}
+
+			// Empty results may come back as nil from the cache, so compare printed values.
+			if fmt.Sprintf("%+v", first) != fmt.Sprintf("%+v", second) {
+				t.Errorf("second call = %+v, want %+v", second, first)
+			}
+			if got := srv.Count(tt.route); got != 1 {
+				t.Errorf("requests = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestCachedRepoGetMoviesByIDsRequestsOnlyMissing(t *testing.T) {
+	repo, cache, srv := newTestRepo(t)
+	ctx := context.Background()
+
+	if _, err := repo.GetMoviesByIDs(ctx, []int{447301, 999999}); err != nil {
+		t.Fatalf("GetMoviesByIDs() error = %v", err)
+	}
+	waitCached(t, func(ctx context.Context) error {
+		_, err := cache.GetMovieByID(ctx, 999999)
+		return err
+	})
+
+	movies, err := repo.GetMoviesByIDs(ctx, []int{840152, 999999, 447301})
+	if err != nil {
+		t.Fatalf("GetMoviesByIDs() error = %v", err)
+	}
+	if got, want := kinopoisktest.MovieIDs(movies), []int{840152, 447301}; !slices.Equal(got, want) {
+		t.Errorf("GetMoviesByIDs() ids = %v, want %v", got, want)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(requests))
+	}
+	query, err := url.ParseQuery(requests[1].Query)
+	if err != nil {
+		t.Fatalf("parse query: %v", err)
+	}
+	if got, want := query["id"], []string{"840152"}; !slices.Equal(got, want) {
+		t.Errorf("second request ids = %v, want %v", got, want)
+	}
+}
+
+func TestCachedRepoCoalescesConcurrentMisses(t *testing.T) {
+	repo, _, srv := newTestRepo(t)
+	srv.SetLatency(50 * time.Millisecond)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = repo.GetMoviesIDByActorID(context.Background(), 1514)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("GetMoviesIDByActorID() error = %v", err)
+	}
+	if got := srv.Count(kinopoisktest.RoutePerson); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestCachedRepoCoalescesConcurrentBatchMisses(t *testing.T) {
+	repo, _, srv := newTestRepo(t)
+	srv.SetLatency(50 * time.Millisecond)
+
+	// Identical searches ask for the same movies, possibly in another order.
+	batches := [][]int{{447301, 840152}, {840152, 447301}}
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			movies, err := repo.GetMoviesByIDs(context.Background(), batches[i%len(batches)])
+			if err == nil && len(movies) != 2 {
+				err = fmt.Errorf("got %d movies, want 2", len(movies))
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("GetMoviesByIDs() error = %v", err)
+	}
+	if got := srv.Count(kinopoisktest.RouteMovies); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestCachedRepoDoesNotCacheErrors(t *testing.T) {
+	repo, _, srv := newTestRepo(t)
+	ctx := context.Background()
+	srv.FailNext(3, http.StatusServiceUnavailable)
+
+	if _, err := repo.SearchActors(ctx, "Том Харди"); !errors.Is(err, domain.ErrUpstreamUnavailable) {
+		t.Fatalf("SearchActors() error = %v, want %v", err, domain.ErrUpstreamUnavailable)
+	}
+	actors, err := repo.SearchActors(ctx, "Том Харди")
+	if err != nil {
+		t.Fatalf("SearchActors() error = %v", err)
+	}
+	if len(actors) == 0 {
+		t.Error("SearchActors() returned no actors after recovery")
+	}
+	if got := srv.Count(kinopoisktest.RouteSearch); got != 4 {
+		t.Errorf("requests = %d, want 4", got)
+	}
+}
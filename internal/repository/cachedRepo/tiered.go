@@ -0,0 +1,190 @@
+package cachedRepo
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/pkg/prometheus"
+	"context"
+	"errors"
+	"slices"
+)
+
+const (
+	tierMemory = "memory"
+	tierRedis  = "redis"
+)
+
+// TieredCache serves lookups from the in-process cache first and falls back to Redis,
+// copying Redis hits into memory. Without Redis it works as a plain memory cache.
+type TieredCache struct {
+	local  CacheRepository
+	remote CacheRepository
+}
+
+// NewTieredCache combines the caches. remote may be nil when Redis is unavailable.
+func NewTieredCache(local CacheRepository, remote CacheRepository) *TieredCache {
+	return &TieredCache{local: local, remote: remote}
+}
+
+func (c *TieredCache) GetMovieByID(ctx context.Context, movieID int) (domain.Movie, error) {
+	return readThrough(ctx, c, entityMovie,
+		func(cache CacheRepository) (domain.Movie, error) {
+			return cache.GetMovieByID(ctx, movieID)
+		},
+		func(movie domain.Movie) error {
+			return c.local.SetMovie(ctx, movie)
+		},
+		func() error {
+			return c.local.SetMoviesNotFound(ctx, []int{movieID})
+		})
+}
+
+func (c *TieredCache) SetMovie(ctx context.Context, movie domain.Movie) error {
+	return c.writeThrough(func(cache CacheRepository) error {
+		return cache.SetMovie(ctx, movie)
+	})
+}
+
+func (c *TieredCache) GetMoviesByIDs(ctx context.Context, movieIDs []int) (domain.MovieLookup, error) {
+	lookup, err := c.local.GetMoviesByIDs(ctx, movieIDs)
+	if err != nil {
+		lookup = domain.NewMovieLookup(len(movieIDs))
+	}
+	missing := make([]int, 0, len(movieIDs))
+	for _, id := range movieIDs {
+		if !lookup.Has(id) {
+			missing = append(missing, id)
+		}
+	}
+	countBatch(tierMemory, lookup, len(missing))
+	if len(missing) == 0 || c.remote == nil {
+		return lookup, nil
+	}
+
+	found, err := c.remote.GetMoviesByIDs(ctx, missing)
+	if err != nil {
+		prometheus.CacheTierOperations.WithLabelValues(tierRedis, entityMovie, "error").Inc()
+		return lookup, err
+	}
+	countBatch(tierRedis, found, len(missing)-len(found.Movies)-len(found.NotFound))
+
+	fresh := make([]domain.Movie, 0, len(found.Movies))
+	for id, movie := range found.Movies {
+		lookup.Movies[id] = movie
+		if !slices.Contains(found.Stale, id) {
+			fresh = append(fresh, movie)
+		}
+	}
+	lookup.Stale = append(lookup.Stale, found.Stale...)
+	lookup.NotFound = append(lookup.NotFound, found.NotFound...)
+	_ = c.local.SetMovies(ctx, fresh)
+	_ = c.local.SetMoviesNotFound(ctx, found.NotFound)
+	return lookup, nil
+}
+
+func (c *TieredCache) SetMovies(ctx context.Context, movies []domain.Movie) error {
+	return c.writeThrough(func(cache CacheRepository) error {
+		return cache.SetMovies(ctx, movies)
+	})
+}
+
+func (c *TieredCache) SetMoviesNotFound(ctx context.Context, movieIDs []int) error {
+	return c.writeThrough(func(cache CacheRepository) error {
+		return cache.SetMoviesNotFound(ctx, movieIDs)
+	})
+}
+
+func (c *TieredCache) GetMoviesIDByActorID(ctx context.Context, actorID int) ([]int, error) {
+	return readThrough(ctx, c, entityFilmography,
+		func(cache CacheRepository) ([]int, error) {
+			return cache.GetMoviesIDByActorID(ctx, actorID)
+		},
+		func(movies []int) error {
+			return c.local.SetMoviesIDByActorID(ctx, actorID, movies)
+		}, nil)
+}
+
+func (c *TieredCache) SetMoviesIDByActorID(ctx context.Context, actorID int, movies []int) error {
+	return c.writeThrough(func(cache CacheRepository) error {
+		return cache.SetMoviesIDByActorID(ctx, actorID, movies)
+	})
+}
+
+func (c *TieredCache) SearchActors(ctx context.Context, query string) ([]domain.Actor, error) {
+	return readThrough(ctx, c, entitySearch,
+		func(cache CacheRepository) ([]domain.Actor, error) {
+			return cache.SearchActors(ctx, query)
+		},
+		func(actors []domain.Actor) error {
+			return c.local.SetSearchActors(ctx, query, actors)
+		},
+		func() error {
+			return c.local.SetSearchNotFound(ctx, query)
+		})
+}
+
+func (c *TieredCache) SetSearchActors(ctx context.Context, query string, actors []domain.Actor) error {
+	return c.writeThrough(func(cache CacheRepository) error {
+		return cache.SetSearchActors(ctx, query, actors)
+	})
+}
+
+func (c *TieredCache) SetSearchNotFound(ctx context.Context, query string) error {
+	return c.writeThrough(func(cache CacheRepository) error {
+		return cache.SetSearchNotFound(ctx, query)
+	})
+}
+
+// readThrough looks the value up tier by tier and promotes fresh Redis hits and
+// "not found" answers into memory. Stale values are left to the background refresh.
+func readThrough[T any](ctx context.Context, c *TieredCache, entity string,
+	get func(cache CacheRepository) (T, error),
+	promote func(value T) error,
+	promoteMissing func() error) (T, error) {
+	value, err := get(c.local)
+	prometheus.CacheTierOperations.WithLabelValues(tierMemory, entity, tierStatus(err)).Inc()
+	if err == nil || errors.Is(err, domain.ErrCachedNotFound) || c.remote == nil {
+		return value, err
+	}
+
+	value, err = get(c.remote)
+	prometheus.CacheTierOperations.WithLabelValues(tierRedis, entity, tierStatus(err)).Inc()
+	switch {
+	case err == nil:
+		_ = promote(value)
+	case errors.Is(err, domain.ErrCachedNotFound) && promoteMissing != nil:
+		_ = promoteMissing()
+	}
+	return value, err
+}
+
+func tierStatus(err error) string {
+	switch {
+	case err == nil:
+		return "hit"
+	case errors.Is(err, domain.ErrStaleRecord):
+		return "stale"
+	case errors.Is(err, domain.ErrCachedNotFound):
+		return "negative"
+	case errors.Is(err, domain.ErrRecordNotFound):
+		return "miss"
+	default:
+		return "error"
+	}
+}
+
+func countBatch(tier string, lookup domain.MovieLookup, missed int) {
+	stale := len(lookup.Stale)
+	prometheus.CacheTierOperations.WithLabelValues(tier, entityMovie, "hit").Add(float64(len(lookup.Movies) - stale))
+	prometheus.CacheTierOperations.WithLabelValues(tier, entityMovie, "stale").Add(float64(stale))
+	prometheus.CacheTierOperations.WithLabelValues(tier, entityMovie, "negative").Add(float64(len(lookup.NotFound)))
+	prometheus.CacheTierOperations.WithLabelValues(tier, entityMovie, "miss").Add(float64(missed))
+}
+
+// writeThrough stores the value in every tier. Only Redis failures are reported.
+func (c *TieredCache) writeThrough(set func(cache CacheRepository) error) error {
+	_ = set(c.local)
+	if c.remote == nil {
+		return nil
+	}
+	return set(c.remote)
+}
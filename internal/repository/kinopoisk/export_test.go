@@ -0,0 +1,4 @@
+package kinopoisk
+
+// MaxBatchSize exposes the list request size to the external tests.
+const MaxBatchSize = maxBatchSize
@@ -0,0 +1,123 @@
+package kinopoisk
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/pkg/prometheus"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+// lastKeyBackoff is how long the last usable key is excluded after 401/403,
+// so a transient authorization failure does not stop all requests for the whole quarantine.
+const lastKeyBackoff = 30 * time.Second
+
+type apiKey struct {
+	value string
+	label string
+	// usageID keys the daily quota counter. It follows the key itself rather than its position,
+	// so a reordered or replaced key does not inherit the usage of another one.
+	usageID string
+	// limiter keeps the request rate of the key, since Kinopoisk limits every key separately.
+	limiter          *rate.Limiter
+	quarantinedUntil time.Time
+	reason           error
+}
+
+// keyPool hands out API keys round-robin and skips keys that are temporarily quarantined
+// after authorization errors, rate limiting or an exhausted daily quota.
+type keyPool struct {
+	mu         sync.Mutex
+	keys       []*apiKey
+	next       int
+	quarantine time.Duration
+}
+
+func newKeyPool(tokens []string, quarantine time.Duration, limit rate.Limit, burst int) *keyPool {
+	keys := make([]*apiKey, 0, len(tokens))
+	for i, token := range tokens {
+		key := &apiKey{
+			value:   token,
+			label:   prometheus.KeyLabel(i),
+			usageID: usageID(token),
+			limiter: rate.NewLimiter(limit, burst),
+		}
+		prometheus.APIKeyAvailable.WithLabelValues(key.label).Set(1)
+		keys = append(keys, key)
+	}
+	return &keyPool{
+		keys:       keys,
+		quarantine: quarantine,
+	}
+}
+
+func (p *keyPool) acquire(now time.Time) (*apiKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var soonest *apiKey
+	for range p.keys {
+		key := p.keys[p.next]
+		p.next = (p.next + 1) % len(p.keys)
+		if !now.Before(key.quarantinedUntil) {
+			if key.reason != nil {
+				key.reason = nil
+				prometheus.APIKeyAvailable.WithLabelValues(key.label).Set(1)
+			}
+			return key, nil
+		}
+		if soonest == nil || key.quarantinedUntil.Before(soonest.quarantinedUntil) {
+			soonest = key
+		}
+	}
+	return nil, fmt.Errorf("all API keys are unavailable until %s: %w",
+		soonest.quarantinedUntil.Format(time.RFC3339), soonest.reason)
+}
+
+// failover quarantines the key if err means it should not be used for a while
+// and reports whether the request may be retried with another key.
+func (p *keyPool) failover(key *apiKey, err error, retryAfter time.Duration, now time.Time) bool {
+	var until time.Time
+	switch {
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		until = nextQuotaDay(now)
+	case errors.Is(err, domain.ErrUnauthorized):
+		until = now.Add(p.quarantine)
+	case errors.Is(err, domain.ErrRateLimited) && len(p.keys) > 1:
+		until = now.Add(max(retryAfter, time.Second))
+	default:
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if errors.Is(err, domain.ErrUnauthorized) && !p.hasOtherUsable(key, now) {
+		until = now.Add(min(p.quarantine, lastKeyBackoff))
+	}
+	if until.After(key.quarantinedUntil) {
+		key.quarantinedUntil = until
+	}
+	key.reason = err
+	prometheus.APIKeyAvailable.WithLabelValues(key.label).Set(0)
+	return len(p.keys) > 1
+}
+
+// hasOtherUsable reports whether a key other than key is not quarantined. p.mu must be held.
+func (p *keyPool) hasOtherUsable(key *apiKey, now time.Time) bool {
+	for _, other := range p.keys {
+		if other != key && !now.Before(other.quarantinedUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+// usageID is a stable identifier of the key from which the key cannot be recovered.
+func usageID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
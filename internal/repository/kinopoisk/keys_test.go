@@ -0,0 +1,94 @@
+package kinopoisk
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"golang.org/x/time/rate"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyPoolUnauthorizedLastKey(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		tokens []string
+		// revoked are failed in order; the last one gets the expected backoff.
+		revoked     int
+		wantBackoff time.Duration
+	}{
+		{name: "single key", tokens: []string{"a"}, revoked: 1, wantBackoff: lastKeyBackoff},
+		{name: "other key usable", tokens: []string{"a", "b"}, revoked: 1, wantBackoff: time.Hour},
+		{name: "other key quarantined", tokens: []string{"a", "b"}, revoked: 2, wantBackoff: lastKeyBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newKeyPool(tt.tokens, time.Hour, rate.Inf, 1)
+			var key *apiKey
+			for range tt.revoked {
+				var err error
+				if key, err = pool.acquire(now); err != nil {
+					t.Fatalf("acquire() error = %v", err)
+				}
+				pool.failover(key, domain.ErrUnauthorized, 0, now)
+			}
+			if got := key.quarantinedUntil.Sub(now); got != tt.wantBackoff {
+				t.Errorf("quarantine = %s, want %s", got, tt.wantBackoff)
+			}
+		})
+	}
+}
+
+func TestKeyPoolLastKeyRecovers(t *testing.T) {
+	now := time.Now()
+	pool := newKeyPool([]string{"a"}, time.Hour, rate.Inf, 1)
+	key, _ := pool.acquire(now)
+	pool.failover(key, domain.ErrUnauthorized, 0, now)
+
+	if _, err := pool.acquire(now.Add(time.Second)); err == nil {
+		t.Fatal("acquire() during backoff: want error")
+	}
+	if _, err := pool.acquire(now.Add(lastKeyBackoff)); err != nil {
+		t.Errorf("acquire() after backoff error = %v", err)
+	}
+}
+
+func TestKeyPoolLimitsEachKey(t *testing.T) {
+	pool := newKeyPool([]string{"a", "b"}, time.Hour, rate.Every(time.Hour), 1)
+	now := time.Now()
+	for range 2 {
+		key, err := pool.acquire(now)
+		if err != nil {
+			t.Fatalf("acquire() error = %v", err)
+		}
+		// Each key has its own burst, so the second key is not slowed down by the first.
+		if !key.limiter.Allow() {
+			t.Errorf("key %s is limited by another key", key.label)
+		}
+	}
+}
+
+func TestKeyLabel(t *testing.T) {
+	pool := newKeyPool([]string{"secret-token"}, time.Hour, rate.Inf, 1)
+	if label := pool.keys[0].label; label != "1" {
+		t.Errorf("label = %q, want %q", label, "1")
+	}
+}
+
+func TestKeyPoolUsageIDFollowsKey(t *testing.T) {
+	first := newKeyPool([]string{"token-a", "token-b"}, time.Hour, rate.Inf, 1)
+	reordered := newKeyPool([]string{"token-b", "token-a"}, time.Hour, rate.Inf, 1)
+
+	if first.keys[0].usageID != reordered.keys[1].usageID {
+		t.Error("usage ID changed when the key moved in the list")
+	}
+	if first.keys[0].usageID == first.keys[1].usageID {
+		t.Error("different keys share a usage ID")
+	}
+	for _, key := range first.keys {
+		if strings.Contains(key.usageID, key.value) || strings.Contains(key.usageID, key.value[len(key.value)-4:]) {
+			t.Errorf("usage ID %q reveals the key", key.usageID)
+		}
+	}
+}
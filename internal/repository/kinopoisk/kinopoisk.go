@@ -4,32 +4,85 @@ import (
 	"KinopoiskTwoActors/configs"
 	"KinopoiskTwoActors/internal/domain"
 	"KinopoiskTwoActors/pkg/prometheus"
+	"KinopoiskTwoActors/pkg/tracing"
 	"context"
 	"encoding/json"
 	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const maxBatchSize = 250
+
+var movieFields = []string{
+	"id", "name", "alternativeName", "rating", "year", "poster", "type", "isSeries",
+}
+
+type movieInfo struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Rating struct {
+		Kp   float32 `json:"kp"`
+		Imdb float32 `json:"imdb"`
+	}
+	Year        int    `json:"year"`
+	Description string `json:"description"`
+	Poster      struct {
+		Url string `json:"url"`
+	}
+	AltName  string `json:"alternativeName"`
+	Type     string `json:"type"`
+	IsSeries bool   `json:"isSeries"`
+}
+
+func (m movieInfo) toDomain() domain.Movie {
+	return domain.Movie{
+		ID:        m.ID,
+		Name:      m.Name,
+		EngName:   m.AltName,
+		PosterURL: m.Poster.Url,
+		Rating:    m.Rating.Kp,
+		Year:      m.Year,
+		Type:      m.Type,
+		IsSeries:  m.IsSeries,
+		MovieURL:  GetFilmURL(m.ID),
+	}
+}
+
 type Repo struct {
 	Path   string
-	APIKey string
 	Client *http.Client
+	cfg    configs.KinopoiskConfig
+	keys   *keyPool
+	usage  UsageCounter
 	log    *slog.Logger
 }
 
-func NewRepo(config *configs.Config) *Repo {
+func NewRepo(config *configs.Config, usage UsageCounter, log *slog.Logger) *Repo {
+	limit := rate.Limit(config.KP.RateLimit)
+	if config.KP.RateLimit == 0 {
+		limit = rate.Inf
+	}
 
 	return &Repo{
-		APIKey: config.KP.Token,
-		Path:   config.KP.Path,
+		Path: config.KP.Path,
 		Client: &http.Client{
-			Timeout: time.Second * 10,
+			Timeout:   time.Second * 10,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
 		},
+		cfg:   config.KP,
+		keys:  newKeyPool(config.KP.Tokens, config.KP.KeyQuarantine, limit, config.KP.RateBurst),
+		usage: usage,
+		log:   log,
 	}
 }
 
@@ -41,36 +94,57 @@ func (repo *Repo) GetMovieByID(ctx context.Context, movieID int) (domain.Movie,
 		return domain.Movie{}, err
 	}
 
-	var movieInfo struct {
-		ID     int    `json:"id"`
-		Name   string `json:"name"`
-		Rating struct {
-			Kp   float32 `json:"kp"`
-			Imdb float32 `json:"imdb"`
-		}
-		Year        int    `json:"year"`
-		Description string `json:"description"`
-		Poster      struct {
-			Url string `json:"url"`
-		}
-		AltName string `json:"alternativeName"`
-	}
-	if err = json.NewDecoder(strings.NewReader(string(resp))).Decode(&movieInfo); err != nil {
+	var info movieInfo
+	if err = json.NewDecoder(strings.NewReader(string(resp))).Decode(&info); err != nil {
 		return domain.Movie{}, err
 	}
 
-	return domain.Movie{
-		ID:        movieInfo.ID,
-		Name:      movieInfo.Name,
-		EngName:   movieInfo.AltName,
-		PosterURL: movieInfo.Poster.Url,
-		Rating:    movieInfo.Rating.Kp,
-		Year:      movieInfo.Year,
-		MovieURL:  GetFilmURL(movieInfo.ID),
-	}, nil
+	return info.toDomain(), nil
 
 }
 
+// GetMoviesByIDs loads movies with one list request per maxBatchSize ids.
+// Movies unknown to Kinopoisk are omitted, the rest keep the order of movieIDs.
+func (repo *Repo) GetMoviesByIDs(ctx context.Context, movieIDs []int) ([]domain.Movie, error) {
+	found := make(map[int]domain.Movie, len(movieIDs))
+	for start := 0; start < len(movieIDs); start += maxBatchSize {
+		batch := movieIDs[start:min(start+maxBatchSize, len(movieIDs))]
+
+		query := url.Values{}
+		query.Set("page", "1")
+		query.Set("limit", strconv.Itoa(len(batch)))
+		for _, field := range movieFields {
+			query.Add("selectFields", field)
+		}
+		for _, id := range batch {
+			query.Add("id", strconv.Itoa(id))
+		}
+
+		resp, err := repo.doRequest(ctx, "movie?"+query.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		var response struct {
+			Docs []movieInfo `json:"docs"`
+		}
+		if err = json.NewDecoder(strings.NewReader(string(resp))).Decode(&response); err != nil {
+			return nil, err
+		}
+		for _, info := range response.Docs {
+			found[info.ID] = info.toDomain()
+		}
+	}
+
+	movies := make([]domain.Movie, 0, len(found))
+	for _, id := range movieIDs {
+		if movie, ok := found[id]; ok {
+			movies = append(movies, movie)
+		}
+	}
+	return movies, nil
+}
+
 func (repo *Repo) GetMoviesIDByActorID(ctx context.Context, actorID int) ([]int, error) {
 
 	req := fmt.Sprintf("person/%d", actorID)
@@ -129,27 +203,142 @@ func (repo *Repo) SearchActors(ctx context.Context, query string) ([]domain.Acto
 }
 
 func (repo *Repo) doRequest(ctx context.Context, endpoint string) ([]byte, error) {
+	ctx, span := tracing.Start(ctx, "kinopoisk.doRequest", attribute.String("endpoint", endpoint))
+	body, err := repo.doWithRetries(ctx, endpoint)
+	tracing.End(span, err)
+	return body, err
+}
+
+func (repo *Repo) doWithRetries(ctx context.Context, endpoint string) ([]byte, error) {
 	const op = "Repo.doRequest"
+	span := trace.SpanFromContext(ctx)
+	for attempt := 0; ; attempt++ {
+		key, err := repo.keys.acquire(time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		body, retryAfter, err := repo.doAttempt(ctx, endpoint, key)
+		if err == nil {
+			return body, nil
+		}
+		span.AddEvent("attempt failed", trace.WithAttributes(
+			attribute.Int("attempt", attempt+1),
+			attribute.String("key", key.label),
+			attribute.String("error", err.Error())))
+		rotated := repo.keys.failover(key, err, retryAfter, time.Now())
+		if !(isRetryable(err) || rotated) || attempt >= repo.cfg.MaxRetries {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if rotated {
+			prometheus.APIRetries.WithLabelValues("key_rotated").Inc()
+			repo.log.WarnContext(ctx, "Смена ключа API Кинопоиска",
+				"endpoint", endpoint,
+				"key", key.label,
+				"error", err)
+			continue
+		}
+
+		delay := repo.backoff(attempt)
+		if retryAfter > 0 {
+			if retryAfter > repo.cfg.RetryMaxDelay {
+				return nil, fmt.Errorf("%s: retry after %s: %w", op, retryAfter, err)
+			}
+			delay = retryAfter
+		}
+		prometheus.APIRetries.WithLabelValues(retryReason(err)).Inc()
+		repo.log.WarnContext(ctx, "Повтор запроса к Кинопоиску",
+			"endpoint", endpoint,
+			"attempt", attempt+1,
+			"delay", delay,
+			"error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%s: %w", op, ctx.Err())
+		}
+	}
+}
+
+func (repo *Repo) doAttempt(ctx context.Context, endpoint string,
+	key *apiKey) ([]byte, time.Duration, error) {
+	if err := key.limiter.Wait(ctx); err != nil {
+		return nil, 0, fmt.Errorf("rate limiter: %w", err)
+	}
+	if err := repo.reserveQuota(ctx, key); err != nil {
+		return nil, 0, err
+	}
+
 	req, err := http.NewRequestWithContext(ctx, "GET", repo.Path+endpoint, nil)
 	if err != nil {
-		return nil, fmt.Errorf("%s: failed to create request:%w", op, err)
+		return nil, 0, fmt.Errorf("failed to create request:%w", err)
 	}
 	req.Header.Add("accept", "application/json")
-	req.Header.Add("X-API-KEY", repo.APIKey)
+	req.Header.Add("X-API-KEY", key.value)
 
 	resp, err := repo.Client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("%s: request failed: %w", op, err)
+		prometheus.APIKeyRequests.WithLabelValues(key.label, "error").Inc()
+		if ctx.Err() != nil {
+			return nil, 0, fmt.Errorf("request failed: %w", err)
+		}
+		return nil, 0, fmt.Errorf("%w: request failed: %v", domain.ErrUpstreamUnavailable, err)
 	}
 	prometheus.APIFailures.WithLabelValues(resp.Status).Inc()
+	prometheus.APIKeyRequests.WithLabelValues(key.label, strconv.Itoa(resp.StatusCode)).Inc()
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%s: bad status %d, response: %s", op, resp.StatusCode, body)
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")),
+			fmt.Errorf("%w: bad status %d, response: %s", classifyStatus(resp.StatusCode),
+				resp.StatusCode, body)
 	}
 
-	return io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: read body: %v", domain.ErrUpstreamUnavailable, err)
+	}
+	return body, 0, nil
+}
+
+// reserveQuota counts the request against the daily quota of the key.
+// Counter failures do not block requests.
+func (repo *Repo) reserveQuota(ctx context.Context, key *apiKey) error {
+	if repo.cfg.DailyQuota == 0 {
+		return nil
+	}
+	used, err := repo.usage.IncrUsage(ctx, quotaDay(time.Now()), key.usageID)
+	if err != nil {
+		repo.log.WarnContext(ctx, "Ошибка учета квоты Кинопоиска", "key", key.label, "error", err)
+		return nil
+	}
+	remaining := max(int64(repo.cfg.DailyQuota)-used, 0)
+	prometheus.APIQuotaRemaining.WithLabelValues(key.label).Set(float64(remaining))
+	if used > int64(repo.cfg.DailyQuota) {
+		return domain.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Ping checks that the Kinopoisk API answers. It sends no API key, so it does not use the quota.
+func (repo *Repo) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, repo.Path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request:%w", err)
+	}
+	resp, err := repo.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: request failed: %v", domain.ErrUpstreamUnavailable, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: bad status %d", domain.ErrUpstreamUnavailable, resp.StatusCode)
+	}
+	return nil
 }
 
 func GetActorURL(actorID int) string {
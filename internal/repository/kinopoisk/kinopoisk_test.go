@@ -0,0 +1,278 @@
+package kinopoisk_test
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/internal/repository/kinopoisk"
+	"KinopoiskTwoActors/internal/repository/kinopoisk/kinopoisktest"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRepoSearchActors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{name: "russian name", query: "Том Харди", want: []int{1514, 5000001}},
+		{name: "english name", query: "tom hardy", want: []int{1514}},
+		{name: "first name only", query: "Tom", want: []int{1514, 9144, 2015035}},
+		{name: "no results", query: "Несуществующий Актер", want: []int{}},
+	}
+
+	repo, _ := kinopoisktest.NewRepo(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actors, err := repo.SearchActors(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("SearchActors() error = %v", err)
+			}
+			if got := kinopoisktest.ActorIDs(actors); !slices.Equal(got, tt.want) {
+				t.Errorf("SearchActors() ids = %v, want %v", got, tt.want)
+			}
+			for _, actor := range actors {
+				if actor.ActorURL != kinopoisk.GetActorURL(actor.ID) {
+					t.Errorf("actor %d url = %q, want %q", actor.ID, actor.ActorURL, kinopoisk.GetActorURL(actor.ID))
+				}
+			}
+		})
+	}
+}
+
+func TestRepoSearchActorsFixesPhotoURL(t *testing.T) {
+	repo, _ := kinopoisktest.NewRepo(t)
+	actors, err := repo.SearchActors(context.Background(), "Tom Holland")
+	if err != nil {
+		t.Fatalf("SearchActors() error = %v", err)
+	}
+	want := "https://image.openmoviedb.com/kinopoisk-st-images/actor_iphone/iphone360_2015035.jpg"
+	if len(actors) != 1 || actors[0].PhotoURL != want {
+		t.Fatalf("SearchActors() = %+v, want one actor with photo %q", actors, want)
+	}
+}
+
+func TestRepoGetMoviesIDByActorID(t *testing.T) {
+	tests := []struct {
+		name    string
+		actorID int
+		want    []int
+		wantErr error
+	}{
+		{name: "only acting roles", actorID: 1514, want: []int{447301, 840152, 716587, 580336, 999999}},
+		{name: "empty filmography", actorID: 5000001, want: []int{}},
+		{name: "unknown actor", actorID: 1, wantErr: domain.ErrRecordNotFound},
+	}
+
+	repo, _ := kinopoisktest.NewRepo(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.GetMoviesIDByActorID(context.Background(), tt.actorID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetMoviesIDByActorID() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !slices.Equal(got, tt.want) {
+				t.Errorf("GetMoviesIDByActorID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoGetMovieByID(t *testing.T) {
+	tests := []struct {
+		name    string
+		movieID int
+		want    domain.Movie
+		wantErr error
+	}{
+		{
+			name:    "film",
+			movieID: 447301,
+			want: domain.Movie{
+				ID:        447301,
+				Name:      "Начало",
+				EngName:   "Inception",
+				PosterURL: "https://image.openmoviedb.com/kinopoisk-images/447301.jpg",
+				MovieURL:  kinopoisk.GetFilmURL(447301),
+				Rating:    8.7,
+				Year:      2010,
+				Type:      "movie",
+			},
+		},
+		{
+			name:    "series",
+			movieID: 716587,
+			want: domain.Movie{
+				ID:        716587,
+				Name:      "Острые козырьки",
+				EngName:   "Peaky Blinders",
+				PosterURL: "https://image.openmoviedb.com/kinopoisk-images/716587.jpg",
+				MovieURL:  kinopoisk.GetFilmURL(716587),
+				Rating:    8.6,
+				Year:      2013,
+				Type:      "tv-series",
+				IsSeries:  true,
+			},
+		},
+		{name: "unknown movie", movieID: 999999, wantErr: domain.ErrRecordNotFound},
+	}
+
+	repo, _ := kinopoisktest.NewRepo(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.GetMovieByID(context.Background(), tt.movieID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetMovieByID() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetMovieByID() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoGetMoviesByIDs(t *testing.T) {
+	many := make([]int, 0, kinopoisk.MaxBatchSize+10)
+	for id := range kinopoisk.MaxBatchSize + 10 {
+		many = append(many, id+1_000_000)
+	}
+	many = append(many, 448)
+
+	tests := []struct {
+		name         string
+		ids          []int
+		want         []int
+		wantRequests int
+	}{
+		{name: "keeps order", ids: []int{840152, 447301, 2213}, want: []int{840152, 447301, 2213}, wantRequests: 1},
+		{name: "omits unknown", ids: []int{999999, 448}, want: []int{448}, wantRequests: 1},
+		{name: "splits into batches", ids: many, want: []int{448}, wantRequests: 2},
+		{name: "empty", ids: nil, want: []int{}, wantRequests: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, srv := kinopoisktest.NewRepo(t)
+			movies, err := repo.GetMoviesByIDs(context.Background(), tt.ids)
+			if err != nil {
+				t.Fatalf("GetMoviesByIDs() error = %v", err)
+			}
+			if got := kinopoisktest.MovieIDs(movies); !slices.Equal(got, tt.want) {
+				t.Errorf("GetMoviesByIDs() ids = %v, want %v", got, tt.want)
+			}
+			if got := srv.Count(kinopoisktest.RouteMovies); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRepoRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		tokens       []string
+		setup        func(srv *kinopoisktest.Server)
+		wantErr      error
+		wantRequests int
+	}{
+		{
+			name:         "recovers from server error",
+			setup:        func(srv *kinopoisktest.Server) { srv.FailNext(1, http.StatusInternalServerError) },
+			wantRequests: 2,
+		},
+		{
+			name:         "gives up after max retries",
+			setup:        func(srv *kinopoisktest.Server) { srv.FailNext(3, http.StatusBadGateway) },
+			wantErr:      domain.ErrUpstreamUnavailable,
+			wantRequests: 3,
+		},
+		{
+			name:         "retries rate limited request",
+			setup:        func(srv *kinopoisktest.Server) { srv.RateLimitNext(2, 0) },
+			wantRequests: 3,
+		},
+		{
+			name:         "retry after exceeds max delay",
+			setup:        func(srv *kinopoisktest.Server) { srv.RateLimitNext(1, time.Second) },
+			wantErr:      domain.ErrRateLimited,
+			wantRequests: 1,
+		},
+		{
+			name:         "does not retry not found",
+			setup:        func(srv *kinopoisktest.Server) { srv.FailNext(1, http.StatusNotFound) },
+			wantErr:      domain.ErrRecordNotFound,
+			wantRequests: 1,
+		},
+		{
+			name:         "does not retry with a single revoked key",
+			setup:        func(srv *kinopoisktest.Server) { srv.RevokeKey(kinopoisktest.Token) },
+			wantErr:      domain.ErrUnauthorized,
+			wantRequests: 1,
+		},
+		{
+			name:         "rotates revoked key",
+			tokens:       []string{kinopoisktest.Token, "second-token"},
+			setup:        func(srv *kinopoisktest.Server) { srv.RevokeKey(kinopoisktest.Token) },
+			wantRequests: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, srv := kinopoisktest.NewRepo(t, tt.tokens...)
+			tt.setup(srv)
+			_, err := repo.GetMovieByID(context.Background(), 447301)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetMovieByID() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := srv.Count(kinopoisktest.RouteMovie); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRepoHonorsContextDeadline(t *testing.T) {
+	repo, srv := kinopoisktest.NewRepo(t)
+	srv.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := repo.GetMovieByID(ctx, 447301)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetMovieByID() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRepoPing(t *testing.T) {
+	repo, srv := kinopoisktest.NewRepo(t)
+	if err := repo.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if got := len(srv.Requests()); got != 0 {
+		t.Errorf("Ping() made %d API requests, want 0", got)
+	}
+}
+
+func TestRepoQuotaIsCountedPerKey(t *testing.T) {
+	srv := kinopoisktest.NewServer(kinopoisktest.DefaultFixtures())
+	defer srv.Close()
+	usage := kinopoisk.NewMemoryUsage()
+	log := slog.New(slog.DiscardHandler)
+	cfg := srv.Config()
+	cfg.KP.DailyQuota = 1
+	cfg.KP.Tokens = []string{kinopoisktest.Token}
+	if _, err := kinopoisk.NewRepo(cfg, usage, log).GetMovieByID(context.Background(), 447301); err != nil {
+		t.Fatalf("GetMovieByID() error = %v", err)
+	}
+
+	// The key is replaced with a new one at the same position, which has made no requests yet.
+	cfg.KP.Tokens = []string{"replacement-token"}
+	if _, err := kinopoisk.NewRepo(cfg, usage, log).GetMovieByID(context.Background(), 447301); err != nil {
+		t.Errorf("GetMovieByID() with a new key error = %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package kinopoisktest
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+)
+
+//go:embed fixtures/*.json
+var defaultFixtures embed.FS
+
+// Person is a person document as returned by person/{id}.
+type Person struct {
+	ID       int           `json:"id"`
+	Name     string        `json:"name"`
+	EngName  string        `json:"enName"`
+	PhotoURL string        `json:"photo"`
+	Birthday string        `json:"birthday"`
+	Movies   []PersonMovie `json:"movies"`
+}
+
+// PersonMovie is an entry of the filmography of a person.
+type PersonMovie struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Profession string `json:"enProfession"`
+}
+
+// Movie is a movie document as returned by movie/{id} and the movie list.
+type Movie struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	AltName  string `json:"alternativeName"`
+	Type     string `json:"type"`
+	IsSeries bool   `json:"isSeries"`
+	Year     int    `json:"year"`
+	Rating   struct {
+		Kp   float32 `json:"kp"`
+		Imdb float32 `json:"imdb"`
+	} `json:"rating"`
+	Poster struct {
+		Url string `json:"url"`
+	} `json:"poster"`
+}
+
+// Fixtures is the data served by the fake API.
+type Fixtures struct {
+	People []Person
+	Movies []Movie
+}
+
+// DefaultFixtures returns the fixtures shipped with the package.
+func DefaultFixtures() Fixtures {
+	fixtures, err := LoadFixtures(defaultFixtures, "fixtures")
+	if err != nil {
+		panic(err)
+	}
+	return fixtures
+}
+
+// LoadFixtures reads people.json and movies.json from dir.
+func LoadFixtures(fsys fs.FS, dir string) (Fixtures, error) {
+	const op = "kinopoisktest.LoadFixtures"
+	var fixtures Fixtures
+	if err := readJSON(fsys, dir+"/people.json", &fixtures.People); err != nil {
+		return Fixtures{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := readJSON(fsys, dir+"/movies.json", &fixtures.Movies); err != nil {
+		return Fixtures{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return fixtures, nil
+}
+
+func readJSON(fsys fs.FS, name string, dst any) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package kinopoisktest
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/internal/repository/kinopoisk"
+	"log/slog"
+	"testing"
+)
+
+// NewRepo starts a server with the default fixtures, closed when the test ends,
+// and returns a repository using it. Tokens replace the default Token when given.
+func NewRepo(t testing.TB, tokens ...string) (*kinopoisk.Repo, *Server) {
+	t.Helper()
+	srv := NewServer(DefaultFixtures())
+	t.Cleanup(srv.Close)
+	cfg := srv.Config()
+	if len(tokens) > 0 {
+		cfg.KP.Tokens = tokens
+	}
+	return kinopoisk.NewRepo(cfg, kinopoisk.NewMemoryUsage(), slog.New(slog.DiscardHandler)), srv
+}
+
+// ActorIDs returns the IDs of actors in order, for comparing results.
+func ActorIDs(actors []domain.Actor) []int {
+	ids := make([]int, 0, len(actors))
+	for _, actor := range actors {
+		ids = append(ids, actor.ID)
+	}
+	return ids
+}
+
+// MovieIDs returns the IDs of movies in order, for comparing results.
+func MovieIDs(movies []domain.Movie) []int {
+	ids := make([]int, 0, len(movies))
+	for _, movie := range movies {
+		ids = append(ids, movie.ID)
+	}
+	return ids
+}
@@ -0,0 +1,315 @@
+// Package kinopoisktest provides a fake kinopoisk.dev API for offline tests.
+package kinopoisktest
+
+import (
+	"KinopoiskTwoActors/configs"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token is the API key accepted by the server unless revoked.
+const Token = "test-token"
+
+// Routes of the fake API as reported by Count.
+const (
+	RouteSearch = "person/search"
+	RoutePerson = "person/{id}"
+	RouteMovie  = "movie/{id}"
+	RouteMovies = "movie"
+)
+
+// Request is a request received by the server.
+type Request struct {
+	Route  string
+	Path   string
+	Query  string
+	APIKey string
+}
+
+type fault struct {
+	status     int
+	retryAfter time.Duration
+}
+
+// Server serves person/search, person/{id}, movie/{id} and the movie list from fixtures.
+// Requests without a valid X-API-KEY are rejected with 401 like the real API.
+type Server struct {
+	srv      *httptest.Server
+	people   map[int]Person
+	order    []int
+	movies   map[int]Movie
+	mu       sync.Mutex
+	latency  time.Duration
+	faults   []fault
+	revoked  map[string]bool
+	requests []Request
+}
+
+// NewServer starts a server with the given fixtures. Close it when the test ends.
+func NewServer(fixtures Fixtures) *Server {
+	s := &Server{
+		people:  make(map[int]Person, len(fixtures.People)),
+		movies:  make(map[int]Movie, len(fixtures.Movies)),
+		revoked: make(map[string]bool),
+	}
+	for _, person := range fixtures.People {
+		s.people[person.ID] = person
+		s.order = append(s.order, person.ID)
+	}
+	for _, movie := range fixtures.Movies {
+		s.movies[movie.ID] = movie
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("HEAD /{$}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("GET /person/search", s.route(RouteSearch, s.search))
+	mux.Handle("GET /person/{id}", s.route(RoutePerson, s.person))
+	mux.Handle("GET /movie/{id}", s.route(RouteMovie, s.movie))
+	mux.Handle("GET /movie", s.route(RouteMovies, s.movieList))
+	s.srv = httptest.NewServer(mux)
+	return s
+}
+
+// URL returns the API base path to use as KINOPOISK_PATH.
+func (s *Server) URL() string {
+	return s.srv.URL + "/"
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Config returns a configuration pointing to the server with short retry delays
+// and an in-memory cache.
+func (s *Server) Config() *configs.Config {
+	return &configs.Config{
+		KP: configs.KinopoiskConfig{
+			Tokens:         []string{Token},
+			Path:           s.URL(),
+			KeyQuarantine:  time.Minute,
+			MaxRetries:     2,
+			RetryBaseDelay: time.Millisecond,
+			RetryMaxDelay:  10 * time.Millisecond,
+			RateBurst:      1,
+			Concurrency:    4,
+		},
+		Cache: configs.CacheConfig{
+			MovieTTL:       time.Hour,
+			FilmographyTTL: time.Hour,
+			SearchTTL:      time.Hour,
+			MemorySize:     100,
+			MemoryTTL:      time.Hour,
+			NegativeTTL:    time.Hour,
+		},
+	}
+}
+
+// SetLatency delays every following response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailNext answers the next n API requests with status.
+func (s *Server) FailNext(n int, status int) {
+	s.addFaults(n, fault{status: status})
+}
+
+// RateLimitNext answers the next n API requests with 429 and the Retry-After header
+// in whole seconds when retryAfter is at least a second.
+func (s *Server) RateLimitNext(n int, retryAfter time.Duration) {
+	s.addFaults(n, fault{status: http.StatusTooManyRequests, retryAfter: retryAfter})
+}
+
+// RevokeKey makes the server answer 401 to requests with the key.
+func (s *Server) RevokeKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[key] = true
+}
+
+// Requests returns the API requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Count returns the number of requests received for the route.
+func (s *Server) Count(route string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int
+	for _, req := range s.requests {
+		if req.Route == route {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Server) addFaults(n int, f fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range n {
+		s.faults = append(s.faults, f)
+	}
+}
+
+// route records the request and applies latency, injected faults and key checks.
+func (s *Server) route(name string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-KEY")
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{
+			Route:  name,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			APIKey: key,
+		})
+		latency := s.latency
+		var f *fault
+		if len(s.faults) > 0 {
+			f = &s.faults[0]
+			s.faults = s.faults[1:]
+		}
+		revoked := s.revoked[key]
+		s.mu.Unlock()
+
+		if latency > 0 {
+			timer := time.NewTimer(latency)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+		switch {
+		case f != nil:
+			if f.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(f.retryAfter.Seconds())))
+			}
+			writeError(w, f.status)
+		case key == "" || revoked:
+			writeError(w, http.StatusUnauthorized)
+		default:
+			next(w, r)
+		}
+	})
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	words := strings.Fields(strings.ToLower(r.URL.Query().Get("query")))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+
+	docs := make([]Person, 0)
+	for _, id := range s.order {
+		person := s.people[id]
+		if len(words) == 0 || !matchWords(words, person.Name, person.EngName) {
+			continue
+		}
+		// Search results do not include filmographies.
+		person.Movies = nil
+		docs = append(docs, person)
+		if len(docs) == limit {
+			break
+		}
+	}
+	writeList(w, docs, limit)
+}
+
+func (s *Server) person(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+	person, ok := s.people[id]
+	if !ok {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, person)
+}
+
+func (s *Server) movie(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+	movie, ok := s.movies[id]
+	if !ok {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, movie)
+}
+
+// movieList serves movie?id=...&id=..., returning only the known movies.
+func (s *Server) movieList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+
+	docs := make([]Movie, 0)
+	for _, value := range query["id"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		if movie, ok := s.movies[id]; ok && len(docs) < limit {
+			docs = append(docs, movie)
+		}
+	}
+	writeList(w, docs, limit)
+}
+
+func matchWords(words []string, names ...string) bool {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if !slices.ContainsFunc(words, func(word string) bool {
+			return !strings.Contains(name, word)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeList[T any](w http.ResponseWriter, docs []T, limit int) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"docs":  docs,
+		"total": len(docs),
+		"limit": limit,
+		"page":  1,
+		"pages": 1,
+	})
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	writeJSON(w, status, map[string]any{
+		"statusCode": status,
+		"message":    http.StatusText(status),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
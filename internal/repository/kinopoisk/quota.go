@@ -0,0 +1,66 @@
+package kinopoisk
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// quotaZone is the time zone in which kinopoisk.dev resets daily limits.
+var quotaZone = time.FixedZone("MSK", 3*60*60)
+
+// UsageCounter persists the number of API requests made per day.
+type UsageCounter interface {
+	IncrUsage(ctx context.Context, day string, key string) (int64, error)
+}
+
+// MemoryUsage counts requests in memory. It is used when Redis is unavailable.
+type MemoryUsage struct {
+	mu     sync.Mutex
+	day    string
+	counts map[string]int64
+}
+
+func NewMemoryUsage() *MemoryUsage {
+	return &MemoryUsage{counts: make(map[string]int64)}
+}
+
+func (u *MemoryUsage) IncrUsage(ctx context.Context, day string, key string) (int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.day != day {
+		u.day = day
+		clear(u.counts)
+	}
+	u.counts[key]++
+	return u.counts[key], nil
+}
+
+// FallbackUsage counts requests in the primary counter and switches to the
+// fallback for every request the primary fails to record.
+type FallbackUsage struct {
+	primary  UsageCounter
+	fallback UsageCounter
+}
+
+func NewFallbackUsage(primary UsageCounter, fallback UsageCounter) *FallbackUsage {
+	return &FallbackUsage{primary: primary, fallback: fallback}
+}
+
+func (u *FallbackUsage) IncrUsage(ctx context.Context, day string, key string) (int64, error) {
+	used, err := u.primary.IncrUsage(ctx, day, key)
+	if err == nil {
+		return used, nil
+	}
+	return u.fallback.IncrUsage(ctx, day, key)
+}
+
+func quotaDay(now time.Time) string {
+	return now.In(quotaZone).Format(time.DateOnly)
+}
+
+// nextQuotaDay returns the moment the daily quota is reset.
+func nextQuotaDay(now time.Time) time.Time {
+	year, month, day := now.In(quotaZone).Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, quotaZone)
+}
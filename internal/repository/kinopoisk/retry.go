@@ -0,0 +1,61 @@
+package kinopoisk
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var errUnexpectedStatus = errors.New("unexpected status")
+
+// backoff returns an exponential delay with full jitter for the given attempt.
+func (repo *Repo) backoff(attempt int) time.Duration {
+	ceiling := repo.cfg.RetryMaxDelay
+	if attempt < 30 {
+		ceiling = min(ceiling, repo.cfg.RetryBaseDelay<<attempt)
+	}
+	return time.Duration(rand.Int64N(int64(ceiling))) + 1
+}
+
+func classifyStatus(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return domain.ErrRateLimited
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return domain.ErrUnauthorized
+	case status == http.StatusNotFound:
+		return domain.ErrRecordNotFound
+	case status >= http.StatusInternalServerError:
+		return domain.ErrUpstreamUnavailable
+	default:
+		return errUnexpectedStatus
+	}
+}
+
+func isRetryable(err error) bool {
+	return errors.Is(err, domain.ErrRateLimited) || errors.Is(err, domain.ErrUpstreamUnavailable)
+}
+
+func retryReason(err error) string {
+	if errors.Is(err, domain.ErrRateLimited) {
+		return "rate_limited"
+	}
+	return "unavailable"
+}
+
+// parseRetryAfter supports both delay-seconds and HTTP-date forms of the header.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
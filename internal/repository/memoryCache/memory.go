@@ -0,0 +1,117 @@
+package memoryCache
+
+import (
+	"KinopoiskTwoActors/configs"
+	"KinopoiskTwoActors/internal/domain"
+	"context"
+	"slices"
+	"time"
+)
+
+// MemoryCache keeps recently used Kinopoisk data in process memory.
+// Each entity has its own LRU of cfg.Cache.MemorySize entries. Slices are cloned
+// on the way in and out so callers never share backing arrays with the cache.
+// Entries live for MemoryTTL and are never reported as stale.
+type MemoryCache struct {
+	movies          *lru[int, domain.Movie]
+	missingMovies   *lru[int, struct{}]
+	filmographies   *lru[int, []int]
+	searches        *lru[string, []domain.Actor]
+	missingSearches *lru[string, struct{}]
+}
+
+func NewCache(cfg *configs.Config) *MemoryCache {
+	size, ttl := cfg.Cache.MemorySize, cfg.Cache.MemoryTTL
+	negativeSize, negativeTTL := size, cfg.Cache.NegativeTTL
+	if negativeTTL == 0 {
+		negativeSize = 0
+	} else if ttl > 0 {
+		negativeTTL = min(ttl, negativeTTL)
+	}
+	return &MemoryCache{
+		movies:          newLRU[int, domain.Movie](size, ttl),
+		missingMovies:   newLRU[int, struct{}](negativeSize, negativeTTL),
+		filmographies:   newLRU[int, []int](size, ttl),
+		searches:        newLRU[string, []domain.Actor](size, ttl),
+		missingSearches: newLRU[string, struct{}](negativeSize, negativeTTL),
+	}
+}
+
+func (c *MemoryCache) GetMovieByID(_ context.Context, movieID int) (domain.Movie, error) {
+	now := time.Now()
+	if movie, ok := c.movies.get(movieID, now); ok {
+		return movie, nil
+	}
+	if _, ok := c.missingMovies.get(movieID, now); ok {
+		return domain.Movie{}, domain.ErrCachedNotFound
+	}
+	return domain.Movie{}, domain.ErrRecordNotFound
+}
+
+func (c *MemoryCache) SetMovie(_ context.Context, movie domain.Movie) error {
+	c.movies.set(movie.ID, movie, time.Now())
+	return nil
+}
+
+func (c *MemoryCache) GetMoviesByIDs(_ context.Context, movieIDs []int) (domain.MovieLookup, error) {
+	now := time.Now()
+	lookup := domain.NewMovieLookup(len(movieIDs))
+	for _, id := range movieIDs {
+		if movie, ok := c.movies.get(id, now); ok {
+			lookup.Movies[id] = movie
+		} else if _, ok := c.missingMovies.get(id, now); ok {
+			lookup.NotFound = append(lookup.NotFound, id)
+		}
+	}
+	return lookup, nil
+}
+
+func (c *MemoryCache) SetMovies(_ context.Context, movies []domain.Movie) error {
+	now := time.Now()
+	for _, movie := range movies {
+		c.movies.set(movie.ID, movie, now)
+	}
+	return nil
+}
+
+func (c *MemoryCache) SetMoviesNotFound(_ context.Context, movieIDs []int) error {
+	now := time.Now()
+	for _, id := range movieIDs {
+		c.missingMovies.set(id, struct{}{}, now)
+	}
+	return nil
+}
+
+func (c *MemoryCache) GetMoviesIDByActorID(_ context.Context, actorID int) ([]int, error) {
+	movies, ok := c.filmographies.get(actorID, time.Now())
+	if !ok {
+		return nil, domain.ErrRecordNotFound
+	}
+	return slices.Clone(movies), nil
+}
+
+func (c *MemoryCache) SetMoviesIDByActorID(_ context.Context, actorID int, movies []int) error {
+	c.filmographies.set(actorID, slices.Clone(movies), time.Now())
+	return nil
+}
+
+func (c *MemoryCache) SearchActors(_ context.Context, query string) ([]domain.Actor, error) {
+	now := time.Now()
+	if actors, ok := c.searches.get(query, now); ok {
+		return slices.Clone(actors), nil
+	}
+	if _, ok := c.missingSearches.get(query, now); ok {
+		return nil, domain.ErrCachedNotFound
+	}
+	return nil, domain.ErrRecordNotFound
+}
+
+func (c *MemoryCache) SetSearchActors(_ context.Context, query string, actors []domain.Actor) error {
+	c.searches.set(query, slices.Clone(actors), time.Now())
+	return nil
+}
+
+func (c *MemoryCache) SetSearchNotFound(_ context.Context, query string) error {
+	c.missingSearches.set(query, struct{}{}, time.Now())
+	return nil
+}
@@ -0,0 +1,195 @@
+package redisCache
+
+import (
+	"KinopoiskTwoActors/configs"
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/pkg/prometheus"
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var errCacheUnavailable = errors.New("redis cache unavailable")
+
+// HealthCheckedRepo bypasses Redis while it is unreachable: lookups report a miss
+// and writes are dropped. Run re-probes Redis and re-enables caching once it answers.
+type HealthCheckedRepo struct {
+	repo      *RedisRepo
+	interval  time.Duration
+	available atomic.Bool
+	log       *slog.Logger
+}
+
+// NewHealthCheckedCache creates the cache without requiring Redis to be up.
+func NewHealthCheckedCache(ctx context.Context, cfg *configs.Config, prefix string,
+	log *slog.Logger) *HealthCheckedRepo {
+	h := &HealthCheckedRepo{
+		repo:     newRepo(cfg, prefix, log),
+		interval: cfg.RD.HealthInterval,
+		log:      log,
+	}
+	h.probe(ctx)
+	return h
+}
+
+// Run re-probes Redis every health interval until ctx is cancelled.
+func (h *HealthCheckedRepo) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.probe(ctx)
+		}
+	}
+}
+
+// Available reports whether Redis answered the last probe or request.
+func (h *HealthCheckedRepo) Available() bool {
+	return h.available.Load()
+}
+
+// Client returns the Redis client, so other stores share its connection pool.
+func (h *HealthCheckedRepo) Client() *redis.Client {
+	return h.repo.client
+}
+
+// Close closes the Redis client shared with the other stores.
+func (h *HealthCheckedRepo) Close() error {
+	return h.repo.client.Close()
+}
+
+// Ping checks Redis directly, regardless of the current availability state.
+func (h *HealthCheckedRepo) Ping(ctx context.Context) error {
+	return h.repo.client.Ping(ctx).Err()
+}
+
+func (h *HealthCheckedRepo) probe(ctx context.Context) {
+	if err := h.Ping(ctx); err != nil {
+		if ctx.Err() == nil {
+			h.setAvailable(false, err)
+		}
+		return
+	}
+	h.setAvailable(true, nil)
+}
+
+func (h *HealthCheckedRepo) setAvailable(available bool, err error) {
+	if available {
+		prometheus.CacheAvailable.Set(1)
+	} else {
+		prometheus.CacheAvailable.Set(0)
+	}
+	if h.available.Swap(available) == available {
+		return
+	}
+	if available {
+		h.log.Info("Подключение к Redis восстановлено, кэширование включено")
+	} else {
+		h.log.Error("Redis недоступен, кэширование отключено", "error", err)
+	}
+}
+
+// observe disables the cache as soon as a request fails on the connection
+// instead of waiting for the next probe. Requests canceled or timed out by the caller
+// say nothing about Redis, so they do not change its availability.
+func (h *HealthCheckedRepo) observe(ctx context.Context, err error) error {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, redis.ErrClosed) {
+		h.setAvailable(false, err)
+	}
+	return err
+}
+
+func (h *HealthCheckedRepo) GetMovieByID(ctx context.Context, movieID int) (domain.Movie, error) {
+	if !h.Available() {
+		return domain.Movie{}, domain.ErrRecordNotFound
+	}
+	movie, err := h.repo.GetMovieByID(ctx, movieID)
+	return movie, h.observe(ctx, err)
+}
+
+func (h *HealthCheckedRepo) SetMovie(ctx context.Context, movie domain.Movie) error {
+	if !h.Available() {
+		return nil
+	}
+	return h.observe(ctx, h.repo.SetMovie(ctx, movie))
+}
+
+func (h *HealthCheckedRepo) GetMoviesByIDs(ctx context.Context, movieIDs []int) (domain.MovieLookup, error) {
+	if !h.Available() {
+		return domain.NewMovieLookup(0), nil
+	}
+	movies, err := h.repo.GetMoviesByIDs(ctx, movieIDs)
+	return movies, h.observe(ctx, err)
+}
+
+func (h *HealthCheckedRepo) SetMovies(ctx context.Context, movies []domain.Movie) error {
+	if !h.Available() {
+		return nil
+	}
+	return h.observe(ctx, h.repo.SetMovies(ctx, movies))
+}
+
+func (h *HealthCheckedRepo) SetMoviesNotFound(ctx context.Context, movieIDs []int) error {
+	if !h.Available() {
+		return nil
+	}
+	return h.observe(ctx, h.repo.SetMoviesNotFound(ctx, movieIDs))
+}
+
+func (h *HealthCheckedRepo) GetMoviesIDByActorID(ctx context.Context, actorID int) ([]int, error) {
+	if !h.Available() {
+		return nil, domain.ErrRecordNotFound
+	}
+	movies, err := h.repo.GetMoviesIDByActorID(ctx, actorID)
+	return movies, h.observe(ctx, err)
+}
+
+func (h *HealthCheckedRepo) SetMoviesIDByActorID(ctx context.Context, actorID int, movies []int) error {
+	if !h.Available() {
+		return nil
+	}
+	return h.observe(ctx, h.repo.SetMoviesIDByActorID(ctx, actorID, movies))
+}
+
+func (h *HealthCheckedRepo) SearchActors(ctx context.Context, query string) ([]domain.Actor, error) {
+	if !h.Available() {
+		return nil, domain.ErrRecordNotFound
+	}
+	actors, err := h.repo.SearchActors(ctx, query)
+	return actors, h.observe(ctx, err)
+}
+
+func (h *HealthCheckedRepo) SetSearchActors(ctx context.Context, query string, actors []domain.Actor) error {
+	if !h.Available() {
+		return nil
+	}
+	return h.observe(ctx, h.repo.SetSearchActors(ctx, query, actors))
+}
+
+func (h *HealthCheckedRepo) SetSearchNotFound(ctx context.Context, query string) error {
+	if !h.Available() {
+		return nil
+	}
+	return h.observe(ctx, h.repo.SetSearchNotFound(ctx, query))
+}
+
+// IncrUsage fails fast while Redis is down so quota accounting does not wait on timeouts.
+func (h *HealthCheckedRepo) IncrUsage(ctx context.Context, day string, keyID string) (int64, error) {
+	if !h.Available() {
+		return 0, errCacheUnavailable
+	}
+	used, err := h.repo.IncrUsage(ctx, day, keyID)
+	return used, h.observe(ctx, err)
+}
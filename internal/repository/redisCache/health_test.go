@@ -0,0 +1,48 @@
+package redisCache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestObserve(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	connErr := &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		err           error
+		wantAvailable bool
+	}{
+		{name: "no error", ctx: context.Background(), err: nil, wantAvailable: true},
+		{name: "caller canceled", ctx: canceled, err: context.Canceled, wantAvailable: true},
+		{name: "caller deadline", ctx: expired, err: context.DeadlineExceeded, wantAvailable: true},
+		{name: "network error after caller deadline", ctx: expired, err: connErr, wantAvailable: true},
+		{name: "wrapped deadline", ctx: context.Background(),
+			err: fmt.Errorf("get: %w", context.DeadlineExceeded), wantAvailable: true},
+		{name: "connection error", ctx: context.Background(), err: connErr, wantAvailable: false},
+		{name: "connection closed", ctx: context.Background(), err: io.EOF, wantAvailable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HealthCheckedRepo{log: slog.New(slog.DiscardHandler)}
+			h.available.Store(true)
+			if err := h.observe(tt.ctx, tt.err); err != tt.err {
+				t.Fatalf("observe() = %v, want %v", err, tt.err)
+			}
+			if got := h.Available(); got != tt.wantAvailable {
+				t.Errorf("Available() = %v, want %v", got, tt.wantAvailable)
+			}
+		})
+	}
+}
@@ -6,20 +6,47 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"log/slog"
 	"strconv"
 	"time"
 )
 
+const (
+	moviePrefix       = "movie:"
+	filmographyPrefix = "filmography:"
+	searchPrefix      = "search:"
+	quotaPrefix       = "quota:"
+	quotaTTL          = 48 * time.Hour
+)
+
+// entry is the stored form of cached values. FreshUntil marks the end of the
+// freshness period; the key itself expires later so stale values can still be served.
+type entry struct {
+	Value      json.RawMessage `json:"value,omitempty"`
+	FreshUntil time.Time       `json:"freshUntil"`
+	NotFound   bool            `json:"notFound,omitempty"`
+}
+
 type RedisRepo struct {
 	client *redis.Client
 	prefix string
+	ttl    configs.CacheConfig
 	log    *slog.Logger
 }
 
-func NewCache(ctx context.Context, cfg *configs.Config, prefix string, log *slog.Logger) (*RedisRepo,
-	error) {
+func newRepo(cfg *configs.Config, prefix string, log *slog.Logger) *RedisRepo {
+	return &RedisRepo{
+		client: newClient(cfg),
+		prefix: prefix,
+		ttl:    cfg.Cache,
+		log:    log,
+	}
+}
+
+// newClient creates a client that records a span for every Redis command.
+func newClient(cfg *configs.Config) *redis.Client {
 	db := redis.NewClient(&redis.Options{
 		Addr:         cfg.RD.Host,
 		DB:           cfg.RD.DB,
@@ -29,46 +56,208 @@ func NewCache(ctx context.Context, cfg *configs.Config, prefix string, log *slog
 		ReadTimeout:  cfg.RD.ReadTimeout,
 		WriteTimeout: cfg.RD.WriteTimeout,
 	})
+	// Instrumentation only fails on invalid options, which are fixed here.
+	_ = redisotel.InstrumentTracing(db, redisotel.WithDBStatement(false))
+	return db
+}
 
-	if err := db.Ping(ctx).Err(); err != nil {
-		log.Error("Ошибка подключения к Redis", "error", err)
-		return &RedisRepo{}, err
+func (r *RedisRepo) GetMovieByID(ctx context.Context, movieID int) (domain.Movie, error) {
+	r.log.DebugContext(ctx, "Получение фильма в Redis", "movieID", movieID)
+	var movie domain.Movie
+	err := r.get(ctx, r.movieKey(movieID), &movie)
+	if err != nil && !errors.Is(err, domain.ErrStaleRecord) {
+		r.log.DebugContext(ctx, "Фильм в Redis не получен", "movieID", movieID, "error", err)
+		return domain.Movie{}, err
 	}
-	log.Info("Клиент подключен к Redis", "host", cfg.RD.Host)
+	return movie, err
+}
 
-	return &RedisRepo{
-		client: db,
-		prefix: prefix,
-		log:    log,
-	}, nil
+func (r *RedisRepo) SetMovie(ctx context.Context, movie domain.Movie) error {
+	return r.set(ctx, r.movieKey(movie.ID), movie, r.ttl.MovieTTL)
 }
 
-func (r *RedisRepo) GetMovieByID(ctx context.Context, movieID int) (domain.Movie, error) {
-	r.log.Debug("Получение фильма в Redis", "movieID", movieID)
-	key := r.prefix + strconv.FormatInt(int64(movieID), 10)
+// GetMoviesByIDs returns the cached subset of movieIDs using a single MGET.
+func (r *RedisRepo) GetMoviesByIDs(ctx context.Context, movieIDs []int) (domain.MovieLookup, error) {
+	lookup := domain.NewMovieLookup(len(movieIDs))
+	if len(movieIDs) == 0 {
+		return lookup, nil
+	}
+
+	keys := make([]string, 0, len(movieIDs))
+	for _, id := range movieIDs {
+		keys = append(keys, r.movieKey(id))
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return domain.MovieLookup{}, err
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var movie domain.Movie
+		switch err := r.decode([]byte(data), &movie); {
+		case err == nil:
+			lookup.Movies[movieIDs[i]] = movie
+		case errors.Is(err, domain.ErrStaleRecord):
+			lookup.Movies[movieIDs[i]] = movie
+			lookup.Stale = append(lookup.Stale, movieIDs[i])
+		case errors.Is(err, domain.ErrCachedNotFound):
+			lookup.NotFound = append(lookup.NotFound, movieIDs[i])
+		}
+	}
+	return lookup, nil
+}
+
+func (r *RedisRepo) SetMovies(ctx context.Context, movies []domain.Movie) error {
+	pipe := r.client.Pipeline()
+	for _, movie := range movies {
+		data, err := r.encode(movie, r.ttl.MovieTTL)
+		if err != nil {
+			return err
+		}
+		pipe.Set(ctx, r.movieKey(movie.ID), data, r.ttl.MovieTTL+r.ttl.StaleTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SetMoviesNotFound caches that the movies do not exist upstream.
+func (r *RedisRepo) SetMoviesNotFound(ctx context.Context, movieIDs []int) error {
+	if r.ttl.NegativeTTL == 0 || len(movieIDs) == 0 {
+		return nil
+	}
+	data, err := r.encode(nil, r.ttl.NegativeTTL)
+	if err != nil {
+		return err
+	}
+	pipe := r.client.Pipeline()
+	for _, id := range movieIDs {
+		pipe.Set(ctx, r.movieKey(id), data, r.ttl.NegativeTTL)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisRepo) GetMoviesIDByActorID(ctx context.Context, actorID int) ([]int, error) {
+	r.log.DebugContext(ctx, "Получение фильмографии в Redis", "actorID", actorID)
+	var movies []int
+	err := r.get(ctx, r.filmographyKey(actorID), &movies)
+	if err != nil && !errors.Is(err, domain.ErrStaleRecord) {
+		r.log.DebugContext(ctx, "Фильмография в Redis не получена", "actorID", actorID, "error", err)
+		return nil, err
+	}
+	return movies, err
+}
+
+func (r *RedisRepo) SetMoviesIDByActorID(ctx context.Context, actorID int, movies []int) error {
+	return r.set(ctx, r.filmographyKey(actorID), movies, r.ttl.FilmographyTTL)
+}
+
+func (r *RedisRepo) SearchActors(ctx context.Context, query string) ([]domain.Actor, error) {
+	r.log.DebugContext(ctx, "Получение результатов поиска в Redis", "query", query)
+	var actors []domain.Actor
+	err := r.get(ctx, r.searchKey(query), &actors)
+	if err != nil && !errors.Is(err, domain.ErrStaleRecord) {
+		r.log.DebugContext(ctx, "Результаты поиска в Redis не получены", "query", query, "error", err)
+		return nil, err
+	}
+	return actors, err
+}
+
+func (r *RedisRepo) SetSearchActors(ctx context.Context, query string, actors []domain.Actor) error {
+	return r.set(ctx, r.searchKey(query), actors, r.ttl.SearchTTL)
+}
+
+// SetSearchNotFound caches that the query has no results.
+func (r *RedisRepo) SetSearchNotFound(ctx context.Context, query string) error {
+	if r.ttl.NegativeTTL == 0 {
+		return nil
+	}
+	data, err := r.encode(nil, r.ttl.NegativeTTL)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.searchKey(query), data, r.ttl.NegativeTTL).Err()
+}
+
+// IncrUsage increments the request counter of the API key with keyID for the given day
+// and returns its new value. keyID never contains the key itself.
+func (r *RedisRepo) IncrUsage(ctx context.Context, day string, keyID string) (int64, error) {
+	key := r.prefix + quotaPrefix + day + ":" + keyID
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, quotaTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (r *RedisRepo) get(ctx context.Context, key string, dst any) error {
 	data, err := r.client.Get(ctx, key).Bytes()
 	if errors.Is(err, redis.Nil) {
-		r.log.Debug("Фильм в базе Redis не найден", "movieID", movieID)
-		return domain.Movie{}, domain.ErrRecordNotFound
+		return domain.ErrRecordNotFound
 	} else if err != nil {
-		r.log.Debug("Ошибка получение данных из Redis", "movieID", movieID)
-		return domain.Movie{}, err
-	}
-
-	var movie domain.Movie
-	if err := json.Unmarshal(data, &movie); err != nil {
-		r.log.Debug("Ошибка конвертации из базы Redis", "movieID", movieID)
-		return domain.Movie{}, err
+		return err
 	}
-	return movie, nil
+	return r.decode(data, dst)
 }
 
-func (r *RedisRepo) SetMovie(ctx context.Context, movie domain.Movie) error {
-	key := r.prefix + strconv.FormatInt(int64(movie.ID), 10)
-	data, err := json.Marshal(movie)
+// set stores the value as fresh for ttl and keeps it for StaleTTL more to be served stale.
+func (r *RedisRepo) set(ctx context.Context, key string, value any, ttl time.Duration) error {
+	data, err := r.encode(value, ttl)
 	if err != nil {
-		r.log.Error("Отправка фильма в базу Redis", "error", err)
+		r.log.Error("Ошибка конвертации данных для Redis", "key", key, "error", err)
 		return err
 	}
-	return r.client.Set(ctx, key, data, 24*time.Hour).Err()
+	return r.client.Set(ctx, key, data, ttl+r.ttl.StaleTTL).Err()
+}
+
+// encode wraps the value into an entry. A nil value is stored as a "not found" answer.
+func (r *RedisRepo) encode(value any, ttl time.Duration) ([]byte, error) {
+	e := entry{FreshUntil: time.Now().Add(ttl), NotFound: value == nil}
+	if value != nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		e.Value = data
+	}
+	return json.Marshal(e)
+}
+
+// decode unpacks an entry into dst. Entries that cannot be decoded are reported as missing
+// so that they are overwritten by fresh data.
+func (r *RedisRepo) decode(data []byte, dst any) error {
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil || (!e.NotFound && len(e.Value) == 0) {
+		r.log.Debug("Ошибка конвертации данных из Redis", "error", err)
+		return domain.ErrRecordNotFound
+	}
+	if e.NotFound {
+		return domain.ErrCachedNotFound
+	}
+	if err := json.Unmarshal(e.Value, dst); err != nil {
+		r.log.Debug("Ошибка конвертации данных из Redis", "error", err)
+		return domain.ErrRecordNotFound
+	}
+	if time.Now().After(e.FreshUntil) {
+		return domain.ErrStaleRecord
+	}
+	return nil
+}
+
+func (r *RedisRepo) movieKey(movieID int) string {
+	return r.prefix + moviePrefix + strconv.Itoa(movieID)
+}
+
+func (r *RedisRepo) filmographyKey(actorID int) string {
+	return r.prefix + filmographyPrefix + strconv.Itoa(actorID)
+}
+
+func (r *RedisRepo) searchKey(query string) string {
+	return r.prefix + searchPrefix + query
 }
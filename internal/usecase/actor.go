@@ -2,8 +2,10 @@ package usecase
 
 import (
 	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/pkg/tracing"
 	"context"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
 	"regexp"
 	"sort"
 	"strings"
@@ -18,6 +20,14 @@ func NewActor(repo ActorFilmRepository) *Actor {
 }
 
 func (uc *Actor) SearchActor(ctx context.Context, query string) ([]domain.Actor, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Actor.SearchActor", attribute.String("query", query))
+	actors, err := uc.searchActor(ctx, query)
+	span.SetAttributes(attribute.Int("actors", len(actors)))
+	tracing.End(span, err)
+	return actors, err
+}
+
+func (uc *Actor) searchActor(ctx context.Context, query string) ([]domain.Actor, error) {
 	const op = "useCase.ActorSearcher"
 
 	if len(query) == 0 {
@@ -27,11 +37,11 @@ func (uc *Actor) SearchActor(ctx context.Context, query string) ([]domain.Actor,
 	actors, err := uc.repo.SearchActors(ctx, query)
 
 	if err != nil {
-		return nil, fmt.Errorf("%s:repo error: %v", op, err)
+		return nil, fmt.Errorf("%s:repo error: %w", op, err)
 	}
 
 	if len(actors) == 0 {
-		return nil, fmt.Errorf("%s:actors not found", op)
+		return nil, fmt.Errorf("%s:actors not found: %w", op, domain.ErrRecordNotFound)
 	}
 
 	normalizedQuery := normalizeName(query)
@@ -0,0 +1,63 @@
+package usecase
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/internal/repository/kinopoisk/kinopoisktest"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestActorSearchActor(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		setup   func(srv *kinopoisktest.Server)
+		want    []int
+		wantErr error
+	}{
+		{name: "exact russian name", query: "Том Харди", want: []int{1514}},
+		{name: "exact english name", query: " tom HARDY ", want: []int{1514}},
+		{name: "ambiguous name skips actors without photo", query: "Том", want: []int{1514, 9144, 2015035}},
+		{name: "empty query", query: "", wantErr: errAny},
+		{name: "not found", query: "Несуществующий Актер", wantErr: domain.ErrRecordNotFound},
+		{
+			name:    "upstream unavailable",
+			query:   "Том Харди",
+			setup:   func(srv *kinopoisktest.Server) { srv.FailNext(3, http.StatusInternalServerError) },
+			wantErr: domain.ErrUpstreamUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, srv := kinopoisktest.NewRepo(t)
+			if tt.setup != nil {
+				tt.setup(srv)
+			}
+			actors, err := NewActor(repo).SearchActor(context.Background(), tt.query)
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("SearchActor() error = %v, want %v", err, tt.wantErr)
+			}
+
+			got := kinopoisktest.ActorIDs(actors)
+			// Actors with equally long filmographies come in no particular order.
+			slices.Sort(got)
+			if tt.wantErr == nil && !slices.Equal(got, tt.want) {
+				t.Errorf("SearchActor() ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// errAny marks test cases that expect an error without a specific sentinel.
+var errAny = errors.New("any error")
+
+func matchErr(err, want error) bool {
+	if want == errAny {
+		return err != nil
+	}
+	return errors.Is(err, want)
+}
@@ -2,59 +2,250 @@ package usecase
 
 import (
 	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/pkg/tracing"
 	"context"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"sort"
+	"sync"
+)
+
+const (
+	minActors = 2
+	// movieBatchSize is the number of movies requested from the repository at once.
+	movieBatchSize = 50
 )
 
 type Film struct {
-	repo ActorFilmRepository
+	repo    ActorFilmRepository
+	workers int
 }
 
-func NewFilm(repo ActorFilmRepository) *Film {
-	return &Film{repo: repo}
+// NewFilm creates the use case. workers bounds the number of concurrent batch lookups.
+func NewFilm(repo ActorFilmRepository, workers int) *Film {
+	return &Film{repo: repo, workers: max(workers, 1)}
 }
 
-func (uc *Film) GetCommonMovies(ctx context.Context, firstActorID int,
-	secondActorID int) ([]domain.Movie, error) {
+// GetCommonMovies returns movies shared by all actors. If some movies could not be loaded,
+// the rest are returned together with an error wrapping domain.ErrPartialResult.
+func (uc *Film) GetCommonMovies(ctx context.Context, actorIDs []int,
+	opts domain.MovieOptions) ([]domain.Movie, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Film.GetCommonMovies",
+		attribute.IntSlice("actor_ids", actorIDs))
+	movies, err := uc.getCommonMovies(ctx, actorIDs, opts)
+	span.SetAttributes(attribute.Int("movies", len(movies)))
+	tracing.End(span, err)
+	return movies, err
+}
 
-	if firstActorID == secondActorID {
-		return nil, fmt.Errorf("актер задублирован")
+func (uc *Film) getCommonMovies(ctx context.Context, actorIDs []int,
+	opts domain.MovieOptions) ([]domain.Movie, error) {
+	if len(actorIDs) < minActors {
+		return nil, fmt.Errorf("для поиска нужно минимум %d актера", minActors)
 	}
 
-	commonMoviesID, err := uc.getCommonMoviesID(ctx, firstActorID, secondActorID)
+	seen := make(map[int]bool, len(actorIDs))
+	for _, id := range actorIDs {
+		if seen[id] {
+			return nil, fmt.Errorf("актер задублирован")
+		}
+		seen[id] = true
+	}
+
+	commonMoviesID, err := uc.getCommonMoviesID(ctx, actorIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	commonMovies := make([]domain.Movie, 0)
-
-	for _, id := range commonMoviesID {
-		movie, err := uc.repo.GetMovieByID(ctx, id)
-		if err != nil {
-			return nil, err
-		}
-		commonMovies = append(commonMovies, movie)
+	commonMovies, err := uc.getMovies(ctx, commonMoviesID)
+	if err != nil && !errors.Is(err, domain.ErrPartialResult) {
+		return nil, err
 	}
 
-	return commonMovies, nil
+	return uc.ApplyOptions(commonMovies, opts), err
 }
 
-func (uc *Film) getCommonMoviesID(ctx context.Context, firstActorID int,
-	secondActorID int) ([]int, error) {
-	movies1, err := uc.repo.GetMoviesIDByActorID(ctx, firstActorID)
+// GetActorMovies returns the filmography of the actor matching opts. Like GetCommonMovies,
+// it returns the loaded movies together with domain.ErrPartialResult if some failed.
+func (uc *Film) GetActorMovies(ctx context.Context, actorID int,
+	opts domain.MovieOptions) ([]domain.Movie, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Film.GetActorMovies",
+		attribute.Int("actor_id", actorID))
+	movies, err := uc.getActorMovies(ctx, actorID, opts)
+	span.SetAttributes(attribute.Int("movies", len(movies)))
+	tracing.End(span, err)
+	return movies, err
+}
+
+func (uc *Film) getActorMovies(ctx context.Context, actorID int,
+	opts domain.MovieOptions) ([]domain.Movie, error) {
+	moviesID, err := uc.repo.GetMoviesIDByActorID(ctx, actorID)
 	if err != nil {
 		return nil, err
 	}
-	movies2, err := uc.repo.GetMoviesIDByActorID(ctx, secondActorID)
-	if err != nil {
+
+	movies, err := uc.getMovies(ctx, moviesID)
+	if err != nil && !errors.Is(err, domain.ErrPartialResult) {
 		return nil, err
 	}
 
-	commonMovies := findCommonMoviesID(movies1, movies2)
+	return uc.ApplyOptions(movies, opts), err
+}
+
+// getMovies loads movies in batches of movieBatchSize using a bounded pool of workers
+// and keeps the order of ids.
+func (uc *Film) getMovies(ctx context.Context, ids []int) ([]domain.Movie, error) {
+	type result struct {
+		movies []domain.Movie
+		err    error
+	}
+	batches := make([][]int, 0, (len(ids)+movieBatchSize-1)/movieBatchSize)
+	for start := 0; start < len(ids); start += movieBatchSize {
+		batches = append(batches, ids[start:min(start+movieBatchSize, len(ids))])
+	}
+	results := make([]result, len(batches))
+	jobs := make(chan int)
+
+	wg := sync.WaitGroup{}
+	for range min(uc.workers, len(batches)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				movies, err := uc.repo.GetMoviesByIDs(ctx, batches[i])
+				results[i] = result{movies: movies, err: err}
+			}
+		}()
+	}
+	for i := range batches {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	movies := make([]domain.Movie, 0, len(ids))
+	var failed int
+	var firstErr error
+	for i, res := range results {
+		if res.err != nil {
+			failed += len(batches[i])
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		movies = append(movies, res.movies...)
+	}
+
+	switch {
+	case failed == 0:
+		return movies, nil
+	case len(movies) == 0:
+		return nil, firstErr
+	default:
+		return movies, fmt.Errorf("%w: не загружено %d из %d фильмов: %v",
+			domain.ErrPartialResult, failed, len(ids), firstErr)
+	}
+}
+
+// ApplyOptions returns movies matching opts in the requested order. The input slice is not modified.
+func (uc *Film) ApplyOptions(movies []domain.Movie, opts domain.MovieOptions) []domain.Movie {
+	result := make([]domain.Movie, 0, len(movies))
+	for _, movie := range movies {
+		if matchOptions(movie, opts) {
+			result = append(result, movie)
+		}
+	}
+
+	switch opts.Sort {
+	case domain.SortYearAsc:
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].Year < result[j].Year
+		})
+	case domain.SortYearDesc:
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].Year > result[j].Year
+		})
+	case domain.SortRatingDesc:
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].Rating > result[j].Rating
+		})
+	}
+	return result
+}
+
+func matchOptions(movie domain.Movie, opts domain.MovieOptions) bool {
+	if movie.Rating < opts.MinRating {
+		return false
+	}
+	if opts.YearFrom != 0 && movie.Year < opts.YearFrom {
+		return false
+	}
+	if opts.YearTo != 0 && (movie.Year == 0 || movie.Year > opts.YearTo) {
+		return false
+	}
+	switch opts.Kind {
+	case domain.KindFilm:
+		return !movie.IsSeries
+	case domain.KindSeries:
+		return movie.IsSeries
+	}
+	return true
+}
+
+// getCommonMoviesID fetches all filmographies concurrently and intersects them.
+func (uc *Film) getCommonMoviesID(ctx context.Context, actorIDs []int) ([]int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	filmographies := make([][]int, len(actorIDs))
+	errs := make([]error, len(actorIDs))
+	wg := sync.WaitGroup{}
+	for i, actorID := range actorIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			filmographies[i], errs[i] = uc.repo.GetMoviesIDByActorID(ctx, actorID)
+			if errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Prefer the error that caused the cancellation over the cancellations themselves.
+	var firstErr error
+	for _, err := range errs {
+		if err != nil && (firstErr == nil || errors.Is(firstErr, context.Canceled)) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	commonMovies := findCommonMoviesID(filmographies...)
 	return commonMovies, nil
 }
 
-func findCommonMoviesID(movies1, movies2 []int) []int {
+// findCommonMoviesID intersects filmographies keeping the order of the last one.
+func findCommonMoviesID(filmographies ...[]int) []int {
+	if len(filmographies) == 0 {
+		return nil
+	}
+
+	common := filmographies[0]
+	for _, movies := range filmographies[1:] {
+		common = intersectMoviesID(common, movies)
+		if len(common) == 0 {
+			return nil
+		}
+	}
+	return common
+}
+
+func intersectMoviesID(movies1, movies2 []int) []int {
 	if len(movies1) == 0 || len(movies2) == 0 {
 		return nil
 	}
@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"KinopoiskTwoActors/internal/domain"
+	"KinopoiskTwoActors/internal/repository/kinopoisk/kinopoisktest"
+	"context"
+	"slices"
+	"testing"
+)
+
+const (
+	tomHardy      = 1514
+	cillianMurphy = 8027
+	leoDiCaprio   = 37859
+	tomHanks      = 9144
+)
+
+func TestFilmGetCommonMovies(t *testing.T) {
+	tests := []struct {
+		name     string
+		actorIDs []int
+		opts     domain.MovieOptions
+		want     []int
+		wantErr  error
+	}{
+		{
+			name:     "keeps order of the last filmography and skips unknown movies",
+			actorIDs: []int{tomHardy, cillianMurphy},
+			want:     []int{716587, 840152, 447301},
+		},
+		{
+			name:     "three actors",
+			actorIDs: []int{tomHardy, cillianMurphy, leoDiCaprio},
+			want:     []int{447301},
+		},
+		{
+			name:     "no common movies",
+			actorIDs: []int{tomHardy, tomHanks},
+			want:     []int{},
+		},
+		{
+			name:     "sort by year",
+			actorIDs: []int{tomHardy, cillianMurphy},
+			opts:     domain.MovieOptions{Sort: domain.SortYearAsc},
+			want:     []int{447301, 716587, 840152},
+		},
+		{
+			name:     "sort by rating",
+			actorIDs: []int{tomHardy, cillianMurphy},
+			opts:     domain.MovieOptions{Sort: domain.SortRatingDesc},
+			want:     []int{447301, 716587, 840152},
+		},
+		{
+			name:     "films only",
+			actorIDs: []int{tomHardy, cillianMurphy},
+			opts:     domain.MovieOptions{Kind: domain.KindFilm},
+			want:     []int{840152, 447301},
+		},
+		{
+			name:     "series only",
+			actorIDs: []int{tomHardy, cillianMurphy},
+			opts:     domain.MovieOptions{Kind: domain.KindSeries},
+			want:     []int{716587},
+		},
+		{
+			name:     "minimal rating",
+			actorIDs: []int{tomHardy, cillianMurphy},
+			opts:     domain.MovieOptions{MinRating: 8},
+			want:     []int{716587, 447301},
+		},
+		{
+			name:     "year range",
+			actorIDs: []int{tomHardy, cillianMurphy},
+			opts:     domain.MovieOptions{YearFrom: 2011, YearTo: 2016},
+			want:     []int{716587},
+		},
+		{name: "single actor", actorIDs: []int{tomHardy}, wantErr: errAny},
+		{name: "duplicate actor", actorIDs: []int{tomHardy, tomHardy}, wantErr: errAny},
+		{name: "unknown actor", actorIDs: []int{tomHardy, 1}, wantErr: domain.ErrRecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := kinopoisktest.NewRepo(t)
+			movies, err := NewFilm(repo, 2).GetCommonMovies(context.Background(), tt.actorIDs, tt.opts)
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("GetCommonMovies() error = %v, want %v", err, tt.wantErr)
+			}
+
+			got := kinopoisktest.MovieIDs(movies)
+			if tt.wantErr == nil && !slices.Equal(got, tt.want) {
+				t.Errorf("GetCommonMovies() ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilmGetActorMovies(t *testing.T) {
+	tests := []struct {
+		name    string
+		actorID int
+		opts    domain.MovieOptions
+		want    []int
+		wantErr error
+	}{
+		{name: "skips unknown movies", actorID: tomHardy, want: []int{447301, 840152, 716587, 580336}},
+		{
+			name:    "options",
+			actorID: tomHardy,
+			opts:    domain.MovieOptions{Kind: domain.KindFilm, Sort: domain.SortYearDesc},
+			want:    []int{840152, 580336, 447301},
+		},
+		{name: "empty filmography", actorID: 5000001, want: []int{}},
+		{name: "unknown actor", actorID: 1, wantErr: domain.ErrRecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := kinopoisktest.NewRepo(t)
+			movies, err := NewFilm(repo, 2).GetActorMovies(context.Background(), tt.actorID, tt.opts)
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("GetActorMovies() error = %v, want %v", err, tt.wantErr)
+			}
+
+			got := kinopoisktest.MovieIDs(movies)
+			if tt.wantErr == nil && !slices.Equal(got, tt.want) {
+				t.Errorf("GetActorMovies() ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilmGetCommonMoviesBatchesRequests(t *testing.T) {
+	repo, srv := kinopoisktest.NewRepo(t)
+	ids := make([]int, 0, 2*movieBatchSize+1)
+	for id := range cap(ids) {
+		ids = append(ids, id+1_000_000)
+	}
+
+	movies, err := NewFilm(repo, 2).getMovies(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("getMovies() error = %v", err)
+	}
+	if len(movies) != 0 {
+		t.Errorf("getMovies() = %d movies, want 0", len(movies))
+	}
+	if got := srv.Count(kinopoisktest.RouteMovies); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+}
@@ -9,4 +9,19 @@ type ActorFilmRepository interface {
 	SearchActors(ctx context.Context, query string) ([]domain.Actor, error)
 	GetMoviesIDByActorID(ctx context.Context, actorID int) ([]int, error)
 	GetMovieByID(ctx context.Context, movieID int) (domain.Movie, error)
+	GetMoviesByIDs(ctx context.Context, movieIDs []int) ([]domain.Movie, error)
+}
+
+// ActorProvider is the actor search used by the delivery layers.
+type ActorProvider interface {
+	SearchActor(ctx context.Context, query string) ([]domain.Actor, error)
+}
+
+// FilmProvider is the movie search used by the delivery layers.
+type FilmProvider interface {
+	GetCommonMovies(ctx context.Context, actorIDs []int,
+		opts domain.MovieOptions) ([]domain.Movie, error)
+	GetActorMovies(ctx context.Context, actorID int,
+		opts domain.MovieOptions) ([]domain.Movie, error)
+	ApplyOptions(movies []domain.Movie, opts domain.MovieOptions) []domain.Movie
 }
@@ -0,0 +1,52 @@
+package logger
+
+import "context"
+
+// Field names of the values taken from the context.
+const (
+	CorrelationIDKey = "correlation_id"
+	ChatIDKey        = "chat_id"
+	UpdateIDKey      = "update_id"
+	StepKey          = "step"
+)
+
+type contextKey int
+
+const (
+	correlationIDContextKey contextKey = iota
+	chatIDContextKey
+	updateIDContextKey
+	stepContextKey
+)
+
+// WithCorrelationID returns a copy of ctx whose log records carry the correlation ID of the session.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDContextKey, correlationID)
+}
+
+// CorrelationID returns the correlation ID stored in ctx or an empty string.
+func CorrelationID(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDContextKey).(string)
+	return correlationID
+}
+
+// WithChatID returns a copy of ctx whose log records carry the Telegram chat ID.
+func WithChatID(ctx context.Context, chatID int64) context.Context {
+	return context.WithValue(ctx, chatIDContextKey, chatID)
+}
+
+// ChatID returns the chat ID stored in ctx.
+func ChatID(ctx context.Context) (int64, bool) {
+	chatID, ok := ctx.Value(chatIDContextKey).(int64)
+	return chatID, ok
+}
+
+// WithUpdateID returns a copy of ctx whose log records carry the Telegram update ID.
+func WithUpdateID(ctx context.Context, updateID int) context.Context {
+	return context.WithValue(ctx, updateIDContextKey, updateID)
+}
+
+// WithStep returns a copy of ctx whose log records carry the dialog step of the session.
+func WithStep(ctx context.Context, step string) context.Context {
+	return context.WithValue(ctx, stepContextKey, step)
+}
@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+)
+
+const (
+	traceIDKey = "trace_id"
+	spanIDKey  = "span_id"
+)
+
+// contextHandler adds the request fields stored in the context and the IDs of the active span
+// to records logged with a context. Fields already set on the record are kept as they are.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := contextAttrs(ctx)
+	if len(attrs) == 0 {
+		return h.Handler.Handle(ctx, record)
+	}
+
+	present := make(map[string]bool, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		present[attr.Key] = true
+		return true
+	})
+	for _, attr := range attrs {
+		if !present[attr.Key] {
+			record.AddAttrs(attr)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func contextAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+
+	var attrs []slog.Attr
+	if correlationID := CorrelationID(ctx); correlationID != "" {
+		attrs = append(attrs, slog.String(CorrelationIDKey, correlationID))
+	}
+	if chatID, ok := ChatID(ctx); ok {
+		attrs = append(attrs, slog.Int64(ChatIDKey, chatID))
+	}
+	if updateID, ok := ctx.Value(updateIDContextKey).(int); ok {
+		attrs = append(attrs, slog.Int(UpdateIDKey, updateID))
+	}
+	if step, ok := ctx.Value(stepContextKey).(string); ok && step != "" {
+		attrs = append(attrs, slog.String(StepKey, step))
+	}
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+		attrs = append(attrs,
+			slog.String(traceIDKey, spanCtx.TraceID().String()),
+			slog.String(spanIDKey, spanCtx.SpanID().String()),
+		)
+	}
+	return attrs
+}
@@ -20,33 +20,33 @@ func NewLogger(cfg *configs.Config) *slog.Logger {
 	switch cfg.Env {
 	case envLocal:
 		multiWriter, err := newMultiWriter("logs/bot.log")
-		logger = slog.New(
+		logger = slog.New(contextHandler{
 			slog.NewJSONHandler(multiWriter, &slog.HandlerOptions{
 				Level:     slog.LevelDebug,
 				AddSource: true,
-			}))
+			})})
 		if err != nil {
-			logger.Error("Error creating log file: ", "error", err)
+			logger.Error("Error creating log file", "error", err)
 		}
 	case envDev:
 		multiWriter, err := newMultiWriter("/var/log/telegram-bot.log")
-		logger = slog.New(
+		logger = slog.New(contextHandler{
 			slog.NewJSONHandler(multiWriter, &slog.HandlerOptions{
 				Level:     slog.LevelDebug,
 				AddSource: true,
-			}))
+			})})
 		if err != nil {
-			logger.Error("Error creating log file: ", err)
+			logger.Error("Error creating log file", "error", err)
 		}
 	case envProd:
 		multiWriter, err := newMultiWriter("/var/log/telegram-bot.log")
-		logger = slog.New(
+		logger = slog.New(contextHandler{
 			slog.NewJSONHandler(multiWriter, &slog.HandlerOptions{
 				Level:     slog.LevelInfo,
 				AddSource: true,
-			}))
+			})})
 		if err != nil {
-			logger.Error("Error creating log file: ", err)
+			logger.Error("Error creating log file", "error", err)
 		}
 	}
 
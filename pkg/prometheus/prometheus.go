@@ -2,6 +2,7 @@ package prometheus
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
 )
 
 var (
@@ -20,10 +21,10 @@ var (
 		},
 		[]string{"command"},
 	)
-	ActiveUsers = prometheus.NewGauge(
+	ActiveSessions = prometheus.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "bot_active_users_total",
-			Help: "Current number of active users",
+			Name: "bot_active_sessions",
+			Help: "Current number of live user sessions",
 		},
 	)
 
@@ -35,6 +36,38 @@ var (
 		[]string{"status"},
 	)
 
+	APIRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bot_api_retries_total",
+			Help: "Count of retried API calls",
+		},
+		[]string{"reason"}, // rate_limited, unavailable
+	)
+
+	APIQuotaRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bot_api_quota_remaining",
+			Help: "Remaining daily Kinopoisk API quota per key",
+		},
+		[]string{"key"},
+	)
+
+	APIKeyRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bot_api_key_requests_total",
+			Help: "Count of Kinopoisk API requests per key",
+		},
+		[]string{"key", "status"},
+	)
+
+	APIKeyAvailable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bot_api_key_available",
+			Help: "Whether the Kinopoisk API key is in rotation (1) or quarantined (0)",
+		},
+		[]string{"key"},
+	)
+
 	MessagesSent = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "bot_messages_sent_total",
@@ -47,7 +80,41 @@ var (
 			Name: "cache_operations_total",
 			Help: "Cache operations",
 		},
-		[]string{"status"},
+		[]string{"entity", "status"}, // movie, filmography, search; hit, stale, negative, miss, error
+	)
+	CacheTierOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_tier_operations_total",
+			Help: "Cache lookups per cache tier",
+		},
+		[]string{"tier", "entity", "status"}, // memory, redis; movie, filmography, search; hit, stale, negative, miss, error
+	)
+	CacheAvailable = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cache_available",
+			Help: "Whether the Redis cache is reachable (1) or bypassed (0)",
+		},
+	)
+	CacheCoalesced = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_coalesced_requests_total",
+			Help: "Cache misses served by an upstream call already in flight",
+		},
+		[]string{"entity"}, // movie, filmography, search
+	)
+	RESTRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rest_api_requests_total",
+			Help: "Count of REST API requests",
+		},
+		[]string{"route", "key", "code"},
+	)
+	UpdateQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bot_update_queue_depth",
+			Help: "Number of updates waiting in worker queue",
+		},
+		[]string{"worker"},
 	)
 )
 
@@ -55,9 +122,24 @@ func init() {
 	prometheus.MustRegister(
 		CommandCounter,
 		CommandDuration,
-		ActiveUsers,
+		ActiveSessions,
 		APIFailures,
+		APIRetries,
+		APIQuotaRemaining,
+		APIKeyRequests,
+		APIKeyAvailable,
 		MessagesSent,
 		CacheOperations,
+		CacheTierOperations,
+		CacheAvailable,
+		CacheCoalesced,
+		RESTRequests,
+		UpdateQueueDepth,
 	)
 }
+
+// KeyLabel is the "key" label of the key at index in the configured list.
+// Only the position is used, so no part of a secret key gets into metrics or logs.
+func KeyLabel(index int) string {
+	return strconv.Itoa(index + 1)
+}